@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type githubContributor struct {
+	ID            int    `json:"id"`
+	Login         string `json:"login"`
+	AvatarURL     string `json:"avatar_url"`
+	Type          string `json:"type"`
+	Contributions int    `json:"contributions"`
+}
+
+type githubCommitActivity struct {
+	Week  int64 `json:"week"`
+	Total int   `json:"total"`
+}
+
+// contributorEnricher 获取仓库贡献最多的贡献者
+type contributorEnricher struct {
+	count int
+}
+
+func (e *contributorEnricher) Name() string {
+	return "contributors"
+}
+
+func (e *contributorEnricher) Enrich(gh *GithubClient, db *gorm.DB, repository Repository) error {
+	path := fmt.Sprintf("/repos/%s/contributors?per_page=%d", repository.FullName, e.count)
+	response, body, err := gh.get(path, nil)
+	if err != nil {
+		return err
+	}
+	var githubContributors []githubContributor
+	switch response.StatusCode {
+	case http.StatusOK:
+		if err := json.Unmarshal(body, &githubContributors); err != nil {
+			return errors.Wrapf(ErrParse, "unmarshal contributors of %s: %s", repository.FullName, err)
+		}
+	case http.StatusNoContent:
+		// 空仓库返回204, 没有贡献者
+	default:
+		return statusError(response, path)
+	}
+
+	contributors := make([]RepositoryContributor, 0, len(githubContributors))
+	for _, c := range githubContributors {
+		contributors = append(contributors, RepositoryContributor{
+			RepositoryID:  repository.ID,
+			Login:         c.Login,
+			UserID:        c.ID,
+			AvatarURL:     c.AvatarURL,
+			Type:          c.Type,
+			Contributions: c.Contributions,
+		})
+	}
+	// 只保留最新的贡献者排名
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("repository_id = ?", repository.ID).Delete(&RepositoryContributor{}).Error; err != nil {
+			return err
+		}
+		if len(contributors) == 0 {
+			return nil
+		}
+		return tx.Create(&contributors).Error
+	})
+}
+
+// commitActivityEnricher 获取仓库最近一年每周的提交数量
+type commitActivityEnricher struct{}
+
+func (e *commitActivityEnricher) Name() string {
+	return "commit_activity"
+}
+
+func (e *commitActivityEnricher) Enrich(gh *GithubClient, db *gorm.DB, repository Repository) error {
+	body, err := gh.GetStats("/repos/" + repository.FullName + "/stats/commit_activity")
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	var weeks []githubCommitActivity
+	if err := json.Unmarshal(body, &weeks); err != nil {
+		return errors.Wrapf(ErrParse, "unmarshal commit activity of %s: %s", repository.FullName, err)
+	}
+	if len(weeks) == 0 {
+		return nil
+	}
+
+	activities := make([]RepositoryCommitActivity, 0, len(weeks))
+	for _, w := range weeks {
+		activities = append(activities, RepositoryCommitActivity{
+			RepositoryID: repository.ID,
+			Week:         time.Unix(w.Week, 0).UTC(),
+			Total:        w.Total,
+		})
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "repository_id"}, {Name: "week"}},
+		DoUpdates: clause.AssignmentColumns([]string{"total"}),
+	}).Create(&activities).Error
+}
+
+// saveRepositoryActivity 获取缓存中仓库的贡献者和提交活跃度, 仓库需要已经通过repo任务保存到数据库
+func saveRepositoryActivity(client *http.Client, db *gorm.DB, sinceType string, languages []string) *RunSummary {
+	summary := NewRunSummary("activity", sinceType)
+	gh := NewGithubClient(client)
+	defer gh.LogQuota()
+
+	names := getCachedRepositoryNames(sinceType, languages, summary)
+	if len(names) == 0 {
+		return summary
+	}
+
+	var repositories []Repository
+	err := db.Select("id", "full_name").Where("full_name IN ?", names).Find(&repositories).Error
+	if err != nil {
+		summary.Abort(errors.Wrap(err, "load repositories"))
+		return summary
+	}
+	if missing := len(names) - len(repositories); missing > 0 {
+		log.WithFields(log.Fields{"missing": missing}).Warn("some repositories not saved yet, run repo task first")
+	}
+
+	enrichers := []RepositoryEnricher{
+		&contributorEnricher{count: Conf.GetContributorCount()},
+		&commitActivityEnricher{},
+	}
+	log.WithFields(log.Fields{"size": len(repositories)}).Info("start fetch repository activity")
+	runEnrichers(gh, db, enrichers, repositories, Conf.GetGithubConcurrency(), summary)
+	return summary
+}
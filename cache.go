@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// 支持的缓存类型
+const (
+	RedisCache = "redis"
+	BoltCache  = "bolt"
+)
+
+// Cache 保存每个since/language/date下仓库最大star数等hash数据的缓存, 每个key都有过期时间
+type Cache interface {
+	// HGetAll 获取key下的所有字段, key不存在或已过期时返回空map
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	// HSet 写入key下的多个字段, 并将key的过期时间重置为ttl
+	HSet(ctx context.Context, key string, values map[string]string, ttl time.Duration) error
+	// Del 删除key
+	Del(ctx context.Context, key string) error
+	Close() error
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   Cache
+)
+
+// getCache 根据cache.driver配置创建缓存, 整个进程共用一个实例, 创建失败时下次调用会重试,
+// bolt缓存文件被其他进程占用时返回ErrLocked
+func getCache() (Cache, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if cache != nil {
+		return cache, nil
+	}
+
+	var err error
+	switch driver := Conf.GetCacheDriver(); driver {
+	case RedisCache:
+		cache = &redisCache{client: getRedisClient()}
+	case BoltCache:
+		var c *boltCache
+		if c, err = openBoltCache(Conf.GetCachePath()); err == nil {
+			cache = c
+		}
+	default:
+		err = errors.Errorf("unknown cache driver %s, choice are redis, bolt", driver)
+	}
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, errors.Wrap(ErrLocked, err.Error())
+	} else if err != nil {
+		return nil, errors.Wrap(ErrCache, err.Error())
+	}
+	return cache, nil
+}
+
+// redisCache 使用Redis hash保存, 多个主机上的任务可以共用
+type redisCache struct {
+	client *redis.Client
+}
+
+func (c *redisCache) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	values, err := c.client.HGetAll(ctx, key).Result()
+	if err == redis.Nil {
+		return map[string]string{}, nil
+	}
+	return values, err
+}
+
+func (c *redisCache) HSet(ctx context.Context, key string, values map[string]string, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+	fields := make(map[string]interface{}, len(values))
+	for field, value := range values {
+		fields[field] = value
+	}
+	pipe := c.client.TxPipeline()
+	pipe.HSet(ctx, key, fields)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *redisCache) Del(ctx context.Context, key string) error {
+	return c.client.Del(ctx, key).Err()
+}
+
+func (c *redisCache) Close() error {
+	return c.client.Close()
+}
+
+// boltExpireBucket 保存每个key的过期时间, 其他每个key对应一个同名的bucket
+var boltExpireBucket = []byte("__expire__")
+
+// boltCache 使用BoltDB文件保存, 适合单机部署和测试, 同一时间只能有一个进程打开
+type boltCache struct {
+	db *bolt.DB
+}
+
+func openBoltCache(path string) (*boltCache, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "open bolt cache %s", path)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltExpireBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "init bolt cache %s", path)
+	}
+	log.WithFields(log.Fields{"path": path}).Info("open bolt cache")
+	return &boltCache{db: db}, nil
+}
+
+// expired 判断key是否已经过期, 没有过期时间的key不会过期
+func (c *boltCache) expired(tx *bolt.Tx, key string) bool {
+	value := tx.Bucket(boltExpireBucket).Get([]byte(key))
+	if len(value) != 8 {
+		return false
+	}
+	expireAt := time.Unix(0, int64(binary.BigEndian.Uint64(value)))
+	return time.Now().After(expireAt)
+}
+
+func (c *boltCache) HGetAll(_ context.Context, key string) (map[string]string, error) {
+	values := make(map[string]string)
+	err := c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(key))
+		if bucket == nil || c.expired(tx, key) {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			values[string(k)] = string(v)
+			return nil
+		})
+	})
+	return values, err
+}
+
+func (c *boltCache) HSet(_ context.Context, key string, values map[string]string, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		// 已过期的key先删除, 与Redis过期后重新写入的行为一致
+		if c.expired(tx, key) {
+			if err := c.delete(tx, key); err != nil {
+				return err
+			}
+		}
+		bucket, err := tx.CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+		for field, value := range values {
+			if err := bucket.Put([]byte(field), []byte(value)); err != nil {
+				return err
+			}
+		}
+		expireAt := make([]byte, 8)
+		binary.BigEndian.PutUint64(expireAt, uint64(time.Now().Add(ttl).UnixNano()))
+		if err := tx.Bucket(boltExpireBucket).Put([]byte(key), expireAt); err != nil {
+			return err
+		}
+		return c.purge(tx)
+	})
+}
+
+func (c *boltCache) Del(_ context.Context, key string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return c.delete(tx, key)
+	})
+}
+
+func (c *boltCache) delete(tx *bolt.Tx, key string) error {
+	if err := tx.DeleteBucket([]byte(key)); err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+	return tx.Bucket(boltExpireBucket).Delete([]byte(key))
+}
+
+// purge 删除所有已过期的key, 避免文件无限增长
+func (c *boltCache) purge(tx *bolt.Tx) error {
+	var keys []string
+	err := tx.Bucket(boltExpireBucket).ForEach(func(k, _ []byte) error {
+		if c.expired(tx, string(k)) {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := c.delete(tx, key); err != nil {
+			return err
+		}
+	}
+	if len(keys) > 0 {
+		log.WithFields(log.Fields{"keys": strings.Join(keys, ",")}).Debug("purge expired bolt cache")
+	}
+	return nil
+}
+
+func (c *boltCache) Close() error {
+	return c.db.Close()
+}
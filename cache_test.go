@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestBoltCache(t *testing.T) *boltCache {
+	t.Helper()
+	c, err := openBoltCache(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func assertHash(t *testing.T, c Cache, key string, want map[string]string) {
+	t.Helper()
+	got, err := c.HGetAll(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("HGetAll(%s) = %v, want %v", key, got, want)
+	}
+}
+
+func TestBoltCacheRoundTrip(t *testing.T) {
+	c := newTestBoltCache(t)
+	ctx := context.Background()
+
+	assertHash(t, c, "missing", map[string]string{})
+	if err := c.HSet(ctx, "repos", map[string]string{"a/b": "1", "c/d": "2"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// 再次写入时与已有字段合并, 与Redis HSET一致
+	if err := c.HSet(ctx, "repos", map[string]string{"c/d": "3", "e/f": "4"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	assertHash(t, c, "repos", map[string]string{"a/b": "1", "c/d": "3", "e/f": "4"})
+	assertHash(t, c, "other", map[string]string{})
+
+	if err := c.Del(ctx, "repos"); err != nil {
+		t.Fatal(err)
+	}
+	assertHash(t, c, "repos", map[string]string{})
+	// 删除不存在的key不报错
+	if err := c.Del(ctx, "repos"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBoltCacheExpire(t *testing.T) {
+	c := newTestBoltCache(t)
+	ctx := context.Background()
+
+	if err := c.HSet(ctx, "daily", map[string]string{"a/b": "1"}, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	assertHash(t, c, "daily", map[string]string{"a/b": "1"})
+	time.Sleep(50 * time.Millisecond)
+	assertHash(t, c, "daily", map[string]string{})
+
+	// 过期后重新写入时不保留过期前的字段
+	if err := c.HSet(ctx, "daily", map[string]string{"c/d": "2"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	assertHash(t, c, "daily", map[string]string{"c/d": "2"})
+}
+
+func TestBoltCachePurge(t *testing.T) {
+	c := newTestBoltCache(t)
+	ctx := context.Background()
+
+	if err := c.HSet(ctx, "stale", map[string]string{"a/b": "1"}, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.HSet(ctx, "fresh", map[string]string{"a/b": "1"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// 写入其他key时删除已过期的bucket和过期时间
+	if err := c.HSet(ctx, "next", map[string]string{"c/d": "2"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("stale")) != nil || tx.Bucket(boltExpireBucket).Get([]byte("stale")) != nil {
+			t.Error("expired key stale was not purged")
+		}
+		for _, key := range []string{"fresh", "next"} {
+			if tx.Bucket([]byte(key)) == nil || tx.Bucket(boltExpireBucket).Get([]byte(key)) == nil {
+				t.Errorf("key %s should be kept", key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertHash(t, c, "fresh", map[string]string{"a/b": "1"})
+}
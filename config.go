@@ -3,8 +3,10 @@ package main
 import (
 	"crypto/tls"
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
@@ -14,6 +16,9 @@ import (
 )
 
 type DBInfo struct {
+	// DBDriver 数据库类型, 可选postgres、mysql、sqlite, sqlite使用name作为数据库文件路径,
+	// sqlite驱动依赖cgo, 发布版本中只有linux/amd64支持
+	DBDriver   string `mapstructure:"driver" yaml:"driver"`
 	DBHost     string `mapstructure:"host" yaml:"host"`
 	DBPort     int    `mapstructure:"port" yaml:"port"`
 	DBUser     string `mapstructure:"user" yaml:"user"`
@@ -21,12 +26,24 @@ type DBInfo struct {
 	DBDBName   string `mapstructure:"name" yaml:"name"`
 	DBSslMode  string `mapstructure:"ssl-mode" yaml:"ssl-mode"`
 	DBTimezone string `mapstructure:"timezone" yaml:"timezone"`
+	BatchSize  int    `mapstructure:"batch-size" yaml:"batch-size"`
+}
+
+// CacheInfo 缓存配置, driver可选redis或bolt, bolt使用path指定的本地文件
+type CacheInfo struct {
+	CacheDriver string `mapstructure:"driver" yaml:"driver"`
+	CachePath   string `mapstructure:"path" yaml:"path"`
 }
 
 type GithubInfo struct {
-	ApiUrl  string `mapstructure:"url" yaml:"url"`
-	Version string `mapstructure:"version" yaml:"version"`
-	AuthKey string `mapstructure:"auth-key" yaml:"auth-key"`
+	ApiUrl      string        `mapstructure:"url" yaml:"url"`
+	Version     string        `mapstructure:"version" yaml:"version"`
+	AuthKey     string        `mapstructure:"auth-key" yaml:"auth-key"`
+	MaxRetries  int           `mapstructure:"max-retries" yaml:"max-retries"`
+	MaxWait     time.Duration `mapstructure:"max-wait" yaml:"max-wait"`
+	Concurrency int           `mapstructure:"concurrency" yaml:"concurrency"`
+	Fetcher     string        `mapstructure:"fetcher" yaml:"fetcher"`
+	GraphqlUrl  string        `mapstructure:"graphql-url" yaml:"graphql-url"`
 }
 
 type RedisInfo struct {
@@ -36,21 +53,92 @@ type RedisInfo struct {
 }
 
 type OpenObserve struct {
-	Protocol     string `mapstructure:"protocol" yaml:"protocol"`
-	Entrypoint   string `mapstructure:"entrypoint" yaml:"entrypoint"`
-	IndexName    string `mapstructure:"index-name" yaml:"index-name"`
-	Organization string `mapstructure:"organization" yaml:"organization"`
-	UserName     string `mapstructure:"username" yaml:"username"`
-	Token        string `mapstructure:"token" yaml:"token"`
+	Protocol           string `mapstructure:"protocol" yaml:"protocol"`
+	Entrypoint         string `mapstructure:"entrypoint" yaml:"entrypoint"`
+	IndexName          string `mapstructure:"index-name" yaml:"index-name"`
+	DeveloperIndexName string `mapstructure:"developer-index-name" yaml:"developer-index-name"`
+	Organization       string `mapstructure:"organization" yaml:"organization"`
+	UserName           string `mapstructure:"username" yaml:"username"`
+	Token              string `mapstructure:"token" yaml:"token"`
+}
+
+// GetDeveloperIndexName 获取Trending developers的索引名称, 未配置时在IndexName后追加_developers
+func (o *OpenObserve) GetDeveloperIndexName() string {
+	if o.DeveloperIndexName != "" {
+		return o.DeveloperIndexName
+	}
+	return o.IndexName + "_developers"
+}
+
+type TrendingInfo struct {
+	Languages        []string            `mapstructure:"languages" yaml:"languages"`
+	SinceLanguages   map[string][]string `mapstructure:"since-languages" yaml:"since-languages"`
+	SpokenLanguages  []string            `mapstructure:"spoken-languages" yaml:"spoken-languages"`
+	LanguageCacheTTL time.Duration       `mapstructure:"language-cache-ttl" yaml:"language-cache-ttl"`
+	// ObservationRetention 每次采集的观测记录保留时长
+	ObservationRetention time.Duration `mapstructure:"observation-retention" yaml:"observation-retention"`
+}
+
+// PipelineInfo pipeline任务的配置
+type PipelineInfo struct {
+	// StaleAfter 仓库距离上次获取超过该时长才重新获取
+	StaleAfter time.Duration `mapstructure:"stale-after" yaml:"stale-after"`
+}
+
+// ScheduleJob serve任务中的一个定时任务, cron为标准的5段格式或@hourly等描述符
+type ScheduleJob struct {
+	Name      string `mapstructure:"name" yaml:"name"`
+	Cron      string `mapstructure:"cron" yaml:"cron"`
+	Task      string `mapstructure:"task" yaml:"task"`
+	Since     string `mapstructure:"since" yaml:"since"`
+	Languages string `mapstructure:"languages" yaml:"languages"`
+}
+
+// ScheduleInfo serve任务的配置
+type ScheduleInfo struct {
+	Jobs []ScheduleJob `mapstructure:"jobs" yaml:"jobs"`
+	// ScheduleTimezone cron表达式使用的时区, 默认UTC
+	ScheduleTimezone string `mapstructure:"timezone" yaml:"timezone"`
+	// StatusAddr 查看定时任务运行状态的HTTP地址, 例如:8080, 为空时不启动
+	StatusAddr string `mapstructure:"status-addr" yaml:"status-addr"`
+	// ShutdownTimeout 收到退出信号后等待正在运行的任务结束的最长时间
+	ShutdownTimeout time.Duration `mapstructure:"shutdown-timeout" yaml:"shutdown-timeout"`
+}
+
+// LockInfo 任务锁配置, 防止多个实例同时运行同一个任务
+type LockInfo struct {
+	// LockWait 锁被其他实例持有时是否等待, 默认直接退出
+	LockWait        bool          `mapstructure:"wait" yaml:"wait"`
+	LockWaitTimeout time.Duration `mapstructure:"wait-timeout" yaml:"wait-timeout"`
+	// LockTTL Redis锁的过期时间, 持有期间每ttl/3续期一次
+	LockTTL time.Duration `mapstructure:"ttl" yaml:"ttl"`
+}
+
+// EnrichInfo 获取仓库信息时可选的附加步骤, 每个步骤都会为每个仓库额外请求一次GitHub API
+type EnrichInfo struct {
+	RepoLanguages bool `mapstructure:"languages" yaml:"languages"`
+	Readme        bool `mapstructure:"readme" yaml:"readme"`
+	Releases      bool `mapstructure:"releases" yaml:"releases"`
+	ReleaseCount  int  `mapstructure:"release-count" yaml:"release-count"`
+	// ContributorCount activity任务获取的贡献者数量
+	ContributorCount int `mapstructure:"contributor-count" yaml:"contributor-count"`
 }
 
 type Config struct {
-	GithubInfo  `mapstructure:"github" yaml:"github"`
-	DBInfo      `mapstructure:"db" yaml:"db"`
-	RedisInfo   `mapstructure:"redis" yaml:"redis"`
-	proxy       bool   `mapstructure:"proxy" yaml:"proxy"`
-	proxyUrl    string `mapstructure:"proxy-url" yaml:"proxy-url"`
-	OpenObserve `mapstructure:"open-observe" yaml:"open-observe"`
+	GithubInfo   `mapstructure:"github" yaml:"github"`
+	TrendingInfo `mapstructure:"trending" yaml:"trending"`
+	DBInfo       `mapstructure:"db" yaml:"db"`
+	RedisInfo    `mapstructure:"redis" yaml:"redis"`
+	CacheInfo    `mapstructure:"cache" yaml:"cache"`
+	proxy        bool   `mapstructure:"proxy" yaml:"proxy"`
+	proxyUrl     string `mapstructure:"proxy-url" yaml:"proxy-url"`
+	OpenObserve  `mapstructure:"open-observe" yaml:"open-observe"`
+	EnrichInfo   `mapstructure:"enrich" yaml:"enrich"`
+	PipelineInfo `mapstructure:"pipeline" yaml:"pipeline"`
+	ScheduleInfo `mapstructure:"schedule" yaml:"schedule"`
+	LockInfo     `mapstructure:"lock" yaml:"lock"`
+	// FailureThreshold 任务失败比例超过该值时以非0状态码退出, 配置为0时任何失败都以非0状态码退出
+	FailureThreshold *float64 `mapstructure:"failure-threshold" yaml:"failure-threshold"`
 }
 
 var Conf *Config
@@ -95,14 +183,224 @@ func watchConfig() {
 	})
 }
 
+// GetCacheDriver 获取缓存类型, 默认redis
+func (c *Config) GetCacheDriver() string {
+	if c.CacheDriver == "" {
+		return RedisCache
+	}
+	return strings.ToLower(c.CacheDriver)
+}
+
+// GetCachePath 获取bolt缓存文件路径
+func (c *Config) GetCachePath() string {
+	if c.CachePath == "" {
+		return "github_trending_cache.db"
+	}
+	return c.CachePath
+}
+
+// GetDBDriver 获取数据库类型, 默认postgres
+func (c *Config) GetDBDriver() string {
+	if c.DBDriver == "" {
+		return PostgresDriver
+	}
+	return strings.ToLower(c.DBDriver)
+}
+
+// GetDNS 根据数据库类型生成连接字符串
 func (c *Config) GetDNS() (dns string) {
-	dns = fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
-		c.DBHost, c.DBUser, c.DBPassword, c.DBDBName, c.DBPort, c.DBSslMode, c.DBTimezone,
-	)
+	switch c.GetDBDriver() {
+	case MysqlDriver:
+		loc := "Local"
+		if c.DBTimezone != "" {
+			loc = url.QueryEscape(c.DBTimezone)
+		}
+		dns = fmt.Sprintf(
+			"%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=%s",
+			c.DBUser, c.DBPassword, c.DBHost, c.DBPort, c.DBDBName, loc,
+		)
+	case SqliteDriver:
+		dns = c.DBDBName
+		if dns == "" {
+			dns = "github_trending.db"
+		}
+	default:
+		dns = fmt.Sprintf(
+			"host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
+			c.DBHost, c.DBUser, c.DBPassword, c.DBDBName, c.DBPort, c.DBSslMode, c.DBTimezone,
+		)
+	}
 	return dns
 }
 
+// GetLanguages 获取since类型对应的语言列表, 优先使用since-languages中的配置, 都未配置时返回默认列表
+func (c *Config) GetLanguages(sinceType string) []string {
+	if languages := c.SinceLanguages[sinceType]; len(languages) > 0 {
+		return languages
+	}
+	if len(c.Languages) > 0 {
+		return c.Languages
+	}
+	return defaultLanguageList
+}
+
+// GetLanguageCacheTTL 获取自动发现的语言列表的缓存时间, 默认一天
+func (c *Config) GetLanguageCacheTTL() time.Duration {
+	if c.LanguageCacheTTL <= 0 {
+		return time.Hour * 24
+	}
+	return c.LanguageCacheTTL
+}
+
+// GetObservationRetention 获取Trending观测记录的保留时长, 默认保留30天
+func (c *Config) GetObservationRetention() time.Duration {
+	if c.ObservationRetention <= 0 {
+		return time.Hour * 24 * 30
+	}
+	return c.ObservationRetention
+}
+
+// GetStaleAfter 获取pipeline任务中仓库信息的过期时长, 默认6小时
+func (c *Config) GetStaleAfter() time.Duration {
+	if c.StaleAfter <= 0 {
+		return time.Hour * 6
+	}
+	return c.StaleAfter
+}
+
+// GetScheduleJobs 获取定时任务列表, 未配置时使用与GitHub Actions工作流相同的默认计划
+func (c *Config) GetScheduleJobs() []ScheduleJob {
+	if len(c.Jobs) > 0 {
+		return c.Jobs
+	}
+	return []ScheduleJob{
+		{Name: "daily_collect", Cron: "0 * * * *", Task: "trending", Since: Daily},
+		{Name: "weekly_collect", Cron: "30 9 * * *", Task: "trending", Since: Weekly},
+		{Name: "daily_save", Cron: "30 9 * * *", Task: "repo", Since: Daily},
+		{Name: "weekly_save", Cron: "40 9 * * 0", Task: "repo", Since: Weekly},
+	}
+}
+
+// GetScheduleLocation 获取cron表达式使用的时区
+func (c *Config) GetScheduleLocation() (*time.Location, error) {
+	if c.ScheduleTimezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(c.ScheduleTimezone)
+}
+
+// GetShutdownTimeout 获取退出时等待正在运行的任务的最长时间, 默认30分钟
+func (c *Config) GetShutdownTimeout() time.Duration {
+	if c.ShutdownTimeout <= 0 {
+		return time.Minute * 30
+	}
+	return c.ShutdownTimeout
+}
+
+// GetLockWaitTimeout 获取等待任务锁的最长时间, 默认30分钟
+func (c *Config) GetLockWaitTimeout() time.Duration {
+	if c.LockWaitTimeout <= 0 {
+		return time.Minute * 30
+	}
+	return c.LockWaitTimeout
+}
+
+// GetLockTTL 获取Redis任务锁的过期时间, 默认1分钟
+func (c *Config) GetLockTTL() time.Duration {
+	if c.LockTTL <= 0 {
+		return time.Minute
+	}
+	return c.LockTTL
+}
+
+// GetFailureThreshold 获取任务失败比例阈值, 未配置或配置为负数时使用默认值
+func (c *Config) GetFailureThreshold() float64 {
+	if c.FailureThreshold == nil || *c.FailureThreshold < 0 {
+		return DefaultFailureThreshold
+	}
+	return *c.FailureThreshold
+}
+
+// GetSpokenLanguages 获取需要采集的自然语言列表, 未配置时返回空字符串即不区分自然语言
+func (c *Config) GetSpokenLanguages() []string {
+	if len(c.SpokenLanguages) == 0 {
+		return []string{""}
+	}
+	return c.SpokenLanguages
+}
+
+// GetGithubApiUrl 获取GitHub API地址, 未配置时使用官方地址
+func (c *Config) GetGithubApiUrl() string {
+	if c.ApiUrl == "" {
+		return DefaultGithubApiUrl
+	}
+	return strings.TrimSuffix(c.ApiUrl, "/")
+}
+
+// GetGithubMaxRetries 获取GitHub API请求的最大重试次数, 默认3次
+func (c *Config) GetGithubMaxRetries() int {
+	if c.MaxRetries <= 0 {
+		return 3
+	}
+	return c.MaxRetries
+}
+
+// GetGithubMaxWait 获取限流时单次等待的最长时间, 默认一小时即一个额度重置周期
+func (c *Config) GetGithubMaxWait() time.Duration {
+	if c.MaxWait <= 0 {
+		return time.Hour
+	}
+	return c.MaxWait
+}
+
+// GetGithubConcurrency 获取并发请求GitHub API的worker数量, 默认4个
+func (c *Config) GetGithubConcurrency() int {
+	if c.Concurrency <= 0 {
+		return 4
+	}
+	return c.Concurrency
+}
+
+// GetGithubFetcher 获取仓库信息的后端, 可选rest或graphql, 默认rest
+func (c *Config) GetGithubFetcher() string {
+	if c.Fetcher == "" {
+		return RestFetcher
+	}
+	return strings.ToLower(c.Fetcher)
+}
+
+// GetGithubGraphqlUrl 获取GitHub GraphQL API地址, 未配置时使用API地址下的/graphql
+func (c *Config) GetGithubGraphqlUrl() string {
+	if c.GraphqlUrl == "" {
+		return c.GetGithubApiUrl() + "/graphql"
+	}
+	return c.GraphqlUrl
+}
+
+// GetReleaseCount 获取每个仓库需要获取的最近release数量, 默认10个
+func (c *Config) GetReleaseCount() int {
+	if c.ReleaseCount <= 0 {
+		return 10
+	}
+	return c.ReleaseCount
+}
+
+// GetContributorCount 获取每个仓库需要获取的贡献者数量, 默认30个
+func (c *Config) GetContributorCount() int {
+	if c.ContributorCount <= 0 {
+		return 30
+	}
+	return c.ContributorCount
+}
+
+// GetDBBatchSize 获取批量写入数据库的记录数, 默认100条
+func (c *Config) GetDBBatchSize() int {
+	if c.BatchSize <= 0 {
+		return 100
+	}
+	return c.BatchSize
+}
+
 func (c *Config) GetGithubAuthHeader() map[string]string {
 	return map[string]string{
 		"Accept":               "application/vnd.github+json",
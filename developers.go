@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+	"gorm.io/gorm"
+)
+
+// DeveloperItem Trending developers页面中单个开发者卡片的解析结果
+type DeveloperItem struct {
+	Login                  string `json:"login"`
+	Name                   string `json:"name"`
+	AvatarURL              string `json:"avatar_url"`
+	PopularRepo            string `json:"popular_repo"`
+	PopularRepoDescription string `json:"popular_repo_description"`
+}
+
+// parseDeveloperItem 从<article>卡片中解析开发者信息
+func parseDeveloperItem(article *html.Node) DeveloperItem {
+	var item DeveloperItem
+	if loginEle := htmlquery.FindOne(article, ".//h1[contains(@class, 'h3')]/a"); loginEle != nil {
+		item.Login = strings.Trim(htmlquery.SelectAttr(loginEle, "href"), "/")
+		item.Name = strings.TrimSpace(htmlquery.InnerText(loginEle))
+	}
+	// 没有设置名称的开发者, 标题处展示的就是login
+	if item.Name == item.Login {
+		item.Name = ""
+	}
+	if avatarEle := htmlquery.FindOne(article, ".//img[contains(@class, 'avatar')]"); avatarEle != nil {
+		item.AvatarURL = htmlquery.SelectAttr(avatarEle, "src")
+	}
+	// 开发者卡片内嵌的<article>即为"Popular repo"
+	if repoEle := htmlquery.FindOne(article, ".//article//h1/a"); repoEle != nil {
+		item.PopularRepo = strings.TrimPrefix(htmlquery.SelectAttr(repoEle, "href"), "/")
+	}
+	if descEle := htmlquery.FindOne(article, ".//article/div"); descEle != nil {
+		item.PopularRepoDescription = strings.TrimSpace(htmlquery.InnerText(descEle))
+	}
+	return item
+}
+
+func getTrendingDevelopers(client *http.Client, sinceType, language string) (developerList []DeveloperItem, err error) {
+	doc, err := fetchTrendingPage(client, TrendingDevelopersUrl, sinceType, language, "")
+	if err != nil {
+		return nil, err
+	}
+	articles := htmlquery.Find(doc, "//article[contains(@class, 'Box-row')]")
+	if len(articles) == 0 && htmlquery.FindOne(doc, "//*[contains(@class, 'blankslate')]") == nil {
+		return nil, errors.Wrapf(ErrParse, "no trending developer found, language: %s", language)
+	}
+	for _, article := range articles {
+		item := parseDeveloperItem(article)
+		if item.Login == "" {
+			log.Warn("skip trending article without developer link")
+			continue
+		}
+		developerList = append(developerList, item)
+	}
+	return developerList, nil
+}
+
+// saveTrendingDevelopers 采集Trending developers并保存到缓存和数据库
+func saveTrendingDevelopers(client *http.Client, db *gorm.DB, sinceType string, languages []string) *RunSummary {
+	ctx := context.Background()
+	summary := NewRunSummary("developers", sinceType)
+	rc, err := getCache()
+	if err != nil {
+		summary.Abort(err)
+		return summary
+	}
+
+	dateStr := getDate(sinceType)
+	date, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		summary.Abort(errors.Wrapf(err, "parse date %s", dateStr))
+		return summary
+	}
+
+	var (
+		developerList    []TrendingDeveloper
+		developerRecords []TrendingDeveloper
+		developerMap     = make(map[string]TrendingDeveloper)
+		created          int
+		update           int
+	)
+	err = db.Select("id", "login", "language").
+		Where(&TrendingDeveloper{Date: date, Since: sinceType}).
+		Find(&developerRecords).Error
+	if err != nil {
+		summary.Abort(errors.Wrap(err, "load trending developer records"))
+		return summary
+	}
+	for _, r := range developerRecords {
+		key := fmt.Sprintf("%s:%s", r.Language, r.Login)
+		developerMap[key] = r
+	}
+
+	for _, language := range languages {
+		items, err := getTrendingDevelopers(client, sinceType, language)
+		if err != nil {
+			log.WithFields(log.Fields{"language": language, "error": err.Error()}).Error("get trending developers error, skip this language")
+			summary.Fail(err)
+			continue
+		}
+		if len(items) == 0 {
+			log.WithFields(log.Fields{"language": language}).Warn("get empty trending developers")
+			continue
+		}
+
+		redisCacheKey := RedisDeveloperCachePrefix + "_" + sinceType + "_" + language + "_" + dateStr
+		var cacheDeveloperMap = make(map[string]string)
+		var obDeveloperRecords []*DeveloperRecord
+
+		for _, item := range items {
+			itemBytes, err := json.Marshal(item)
+			if err != nil {
+				log.WithFields(log.Fields{"login": item.Login, "error": err.Error()}).Error("marshal developer item error")
+				continue
+			}
+			cacheDeveloperMap[item.Login] = string(itemBytes)
+
+			obDr := &DeveloperRecord{
+				Date:                   dateStr,
+				Login:                  item.Login,
+				Name:                   item.Name,
+				AvatarURL:              item.AvatarURL,
+				PopularRepo:            item.PopularRepo,
+				PopularRepoDescription: item.PopularRepoDescription,
+				Since:                  sinceType,
+				Language:               language,
+			}
+			tempDeveloper := TrendingDeveloper{
+				Date:                   date,
+				Login:                  item.Login,
+				Name:                   item.Name,
+				AvatarURL:              item.AvatarURL,
+				PopularRepo:            item.PopularRepo,
+				PopularRepoDescription: item.PopularRepoDescription,
+				Since:                  sinceType,
+				Language:               language,
+			}
+			key := fmt.Sprintf("%s:%s", language, item.Login)
+			if developer, ok := developerMap[key]; !ok {
+				created = created + 1
+				obDr.Action = "create"
+			} else {
+				tempDeveloper.ID = developer.ID
+				update = update + 1
+				obDr.Action = "update"
+				obDr.DeveloperId = developer.ID
+			}
+			developerList = append(developerList, tempDeveloper)
+			obDeveloperRecords = append(obDeveloperRecords, obDr)
+		}
+
+		// 推送到OpenObserve
+		EmitDeveloperMessage(obDeveloperRecords)
+
+		// 添加到缓存
+		duration := getCacheDuration(sinceType)
+		err = rc.HSet(ctx, redisCacheKey, cacheDeveloperMap, duration)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"redis_cache_key": redisCacheKey,
+			}).Error(err)
+		}
+		log.WithFields(log.Fields{
+			"size":   len(cacheDeveloperMap),
+			"key":    redisCacheKey,
+			"expire": duration,
+		}).Info("save developers to cache.")
+		summary.Success()
+	}
+
+	if len(developerList) == 0 {
+		log.WithFields(log.Fields{"since": sinceType}).Error("no trending developer collected")
+		return summary
+	}
+	// 添加到数据库
+	if err := db.Save(&developerList).Error; err != nil {
+		summary.Abort(errors.Wrap(err, "save trending developers"))
+		return summary
+	}
+	log.WithFields(log.Fields{"created": created, "update": update}).Info("save all trending developers successful!")
+	return summary
+}
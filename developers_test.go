@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/htmlquery"
+)
+
+func TestParseDeveloperItem(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/trending_developer.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		html string
+		want DeveloperItem
+	}{
+		{
+			name: "full card",
+			html: string(fixture),
+			want: DeveloperItem{
+				Login:                  "alice",
+				Name:                   "Alice Smith",
+				AvatarURL:              "https://avatars.githubusercontent.com/u/1001?s=96&v=4",
+				PopularRepo:            "alice/tool",
+				PopularRepoDescription: "A fast tool for parsing & collecting things",
+			},
+		},
+		{
+			// 没有设置名称时标题展示login, 没有Popular repo时不包含内嵌的<article>
+			name: "without name and popular repo",
+			html: `<article class="Box-row d-flex" id="pa-bob">
+  <div class="mx-3"><a href="/bob"><img class="rounded avatar-user" src="https://avatars.githubusercontent.com/u/1002?s=96&amp;v=4" alt="@bob" /></a></div>
+  <div class="d-sm-flex flex-auto">
+    <div class="col-md-6"><h1 class="h3 lh-condensed"><a href="/bob" class="Link"> bob </a></h1></div>
+  </div>
+</article>`,
+			want: DeveloperItem{Login: "bob", AvatarURL: "https://avatars.githubusercontent.com/u/1002?s=96&v=4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := htmlquery.Parse(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			article := htmlquery.FindOne(doc, "//article[contains(@class, 'Box-row')]")
+			if article == nil {
+				t.Fatal("no developer article in fixture")
+			}
+			if got := parseDeveloperItem(article); got != tt.want {
+				t.Errorf("parseDeveloperItem() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	RestFetcher    = "rest"
+	GraphqlFetcher = "graphql"
+)
+
+// repositoryResult 单个仓库的获取结果
+type repositoryResult struct {
+	Name       string
+	Repository Repository
+	Changed    bool
+	Err        error
+}
+
+// RepositoryFetcher 获取仓库详细信息的后端, saved为已保存仓库的ETag信息, 结果通过channel返回
+type RepositoryFetcher interface {
+	Fetch(names []string, saved map[string]Repository) <-chan repositoryResult
+}
+
+// newRepositoryFetcher 根据配置创建获取仓库信息的后端
+func newRepositoryFetcher(gh *GithubClient) RepositoryFetcher {
+	switch fetcher := Conf.GetGithubFetcher(); fetcher {
+	case GraphqlFetcher:
+		return &graphqlRepositoryFetcher{gh: gh, endpoint: Conf.GetGithubGraphqlUrl(), concurrency: Conf.GetGithubConcurrency()}
+	case RestFetcher:
+		return &restRepositoryFetcher{gh: gh, concurrency: Conf.GetGithubConcurrency()}
+	default:
+		log.WithFields(log.Fields{"fetcher": fetcher}).Warn("unknown repository fetcher, use rest instead")
+		return &restRepositoryFetcher{gh: gh, concurrency: Conf.GetGithubConcurrency()}
+	}
+}
+
+// restRepositoryFetcher 通过REST API逐个获取仓库信息, 支持ETag条件请求
+type restRepositoryFetcher struct {
+	gh          *GithubClient
+	concurrency int
+}
+
+// Fetch 使用固定数量的worker并发获取仓库信息
+func (f *restRepositoryFetcher) Fetch(names []string, saved map[string]Repository) <-chan repositoryResult {
+	jobs := make(chan string)
+	results := make(chan repositoryResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < f.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				s := saved[name]
+				r, changed, err := f.gh.GetRepositoryIfChanged(name, s.ETag, s.LastModified)
+				results <- repositoryResult{Name: name, Repository: r, Changed: changed, Err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for _, name := range names {
+			jobs <- name
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// RepositoryEnricher 仓库信息保存后执行的可选附加步骤, 每个步骤会额外请求GitHub API
+type RepositoryEnricher interface {
+	Name() string
+	// Enrich 获取单个仓库的附加信息并保存到数据库
+	Enrich(gh *GithubClient, db *gorm.DB, repository Repository) error
+}
+
+// newRepositoryEnrichers 根据配置创建启用的附加步骤
+func newRepositoryEnrichers() (enrichers []RepositoryEnricher) {
+	if Conf.EnrichInfo.RepoLanguages {
+		enrichers = append(enrichers, &languageEnricher{})
+	}
+	if Conf.EnrichInfo.Readme {
+		enrichers = append(enrichers, &readmeEnricher{})
+	}
+	if Conf.EnrichInfo.Releases {
+		enrichers = append(enrichers, &releaseEnricher{count: Conf.GetReleaseCount()})
+	}
+	return enrichers
+}
+
+type enrichJob struct {
+	enricher   RepositoryEnricher
+	repository Repository
+}
+
+// runEnrichers 使用固定数量的worker对一批仓库执行附加步骤, 返回每个步骤失败的数量, summary不为nil时同时记录每个步骤的结果
+func runEnrichers(gh *GithubClient, db *gorm.DB, enrichers []RepositoryEnricher, repositories []Repository, concurrency int, summary *RunSummary) map[string]int {
+	failed := make(map[string]int)
+	if len(enrichers) == 0 || len(repositories) == 0 {
+		return failed
+	}
+	jobs := make(chan enrichJob)
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				err := job.enricher.Enrich(gh, db, job.repository)
+				if err != nil {
+					log.WithFields(log.Fields{
+						"enricher":   job.enricher.Name(),
+						"repository": job.repository.FullName,
+						"error":      err.Error(),
+					}).Error("enrich repository error")
+				}
+				mu.Lock()
+				if err != nil {
+					failed[job.enricher.Name()] = failed[job.enricher.Name()] + 1
+					if summary != nil {
+						summary.Fail(err)
+					}
+				} else if summary != nil {
+					summary.Success()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, repository := range repositories {
+		for _, enricher := range enrichers {
+			jobs <- enrichJob{enricher: enricher, repository: repository}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return failed
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// languageEnricher 获取仓库各语言的代码字节数
+type languageEnricher struct{}
+
+func (e *languageEnricher) Name() string {
+	return "languages"
+}
+
+func (e *languageEnricher) Enrich(gh *GithubClient, db *gorm.DB, repository Repository) error {
+	body, err := gh.Get("/repos/" + repository.FullName + "/languages")
+	if err != nil {
+		return err
+	}
+	var languageBytes map[string]int64
+	if err := json.Unmarshal(body, &languageBytes); err != nil {
+		return errors.Wrapf(ErrParse, "unmarshal languages of %s: %s", repository.FullName, err)
+	}
+
+	languages := make([]RepositoryLanguage, 0, len(languageBytes))
+	for language, size := range languageBytes {
+		languages = append(languages, RepositoryLanguage{
+			RepositoryID: repository.ID,
+			Language:     language,
+			Bytes:        size,
+		})
+	}
+	// 仓库可能移除了某些语言, 先删除旧的记录再写入
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("repository_id = ?", repository.ID).Delete(&RepositoryLanguage{}).Error; err != nil {
+			return err
+		}
+		if len(languages) == 0 {
+			return nil
+		}
+		return tx.Create(&languages).Error
+	})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// ReadmeSummaryParagraphs README摘要保留的段落数量
+	ReadmeSummaryParagraphs = 3
+	// ReadmeSummaryMaxLength README摘要的最大字符数
+	ReadmeSummaryMaxLength = 1000
+)
+
+var (
+	readmeCodeBlockRe = regexp.MustCompile("(?s)```.*?```")
+	readmeCommentRe   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	readmeHtmlTagRe   = regexp.MustCompile(`(?s)<[^>]+>`)
+	readmeImageRe     = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	readmeLinkRe      = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	readmeRefLinkRe   = regexp.MustCompile(`\[([^\]]*)\]\[[^\]]*\]`)
+	readmeRefDefRe    = regexp.MustCompile(`(?m)^\s*\[[^\]]+\]:\s*\S+.*$`)
+	readmeEmphasisRe  = regexp.MustCompile("[*_`~]+")
+)
+
+type readmeContent struct {
+	Path     string `json:"path"`
+	SHA      string `json:"sha"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
+// extractReadmeSummary 从README的markdown中提取前几段纯文本, 跳过标题、图片、徽章和代码块
+func extractReadmeSummary(markdown string) string {
+	text := readmeCodeBlockRe.ReplaceAllString(markdown, "\n")
+	text = readmeCommentRe.ReplaceAllString(text, "")
+	text = readmeImageRe.ReplaceAllString(text, "")
+	text = readmeHtmlTagRe.ReplaceAllString(text, "")
+	text = readmeRefDefRe.ReplaceAllString(text, "")
+	text = readmeLinkRe.ReplaceAllString(text, "$1")
+	text = readmeRefLinkRe.ReplaceAllString(text, "$1")
+
+	var paragraphs []string
+	for _, block := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		var lines []string
+		for _, line := range strings.Split(block, "\n") {
+			line = strings.TrimSpace(line)
+			// 跳过标题、表格和分隔线
+			if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "|") ||
+				strings.Trim(line, "-=*_ ") == "" {
+				continue
+			}
+			line = strings.TrimSpace(readmeEmphasisRe.ReplaceAllString(line, ""))
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		paragraphs = append(paragraphs, strings.Join(lines, " "))
+		if len(paragraphs) >= ReadmeSummaryParagraphs {
+			break
+		}
+	}
+
+	summary := strings.Join(paragraphs, "\n\n")
+	if runes := []rune(summary); len(runes) > ReadmeSummaryMaxLength {
+		summary = string(runes[:ReadmeSummaryMaxLength])
+	}
+	return summary
+}
+
+// readmeEnricher 获取仓库的README, 只有blob SHA变化时才保存新的内容
+type readmeEnricher struct{}
+
+func (e *readmeEnricher) Name() string {
+	return "readme"
+}
+
+func (e *readmeEnricher) Enrich(gh *GithubClient, db *gorm.DB, repository Repository) error {
+	var latest RepositoryReadme
+	err := db.Select("sha", "etag").
+		Where("repository_id = ?", repository.ID).
+		Order("updated_time DESC").
+		Limit(1).
+		Find(&latest).Error
+	if err != nil {
+		return err
+	}
+
+	header := make(map[string]string)
+	if latest.ETag != "" {
+		header["If-None-Match"] = latest.ETag
+	}
+	response, body, err := gh.get("/repos/"+repository.FullName+"/readme", header)
+	if errors.Is(err, ErrNotFound) {
+		log.WithFields(log.Fields{"repository": repository.FullName}).Debug("repository has no readme")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusNotModified {
+		return nil
+	} else if response.StatusCode != http.StatusOK {
+		return statusError(response, "/repos/"+repository.FullName+"/readme")
+	}
+
+	var readme readmeContent
+	if err := json.Unmarshal(body, &readme); err != nil {
+		return errors.Wrapf(ErrParse, "unmarshal readme of %s: %s", repository.FullName, err)
+	}
+	if readme.SHA == latest.SHA {
+		return db.Model(&RepositoryReadme{}).
+			Where("repository_id = ? AND sha = ?", repository.ID, readme.SHA).
+			Update("etag", response.Header.Get("ETag")).Error
+	}
+	if readme.Encoding != "base64" {
+		return errors.Wrapf(ErrParse, "unknown readme encoding %s of %s", readme.Encoding, repository.FullName)
+	}
+	content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(readme.Content, "\n", ""))
+	if err != nil {
+		return errors.Wrapf(ErrParse, "decode readme of %s: %s", repository.FullName, err)
+	}
+
+	markdown := string(content)
+	etag := response.Header.Get("ETag")
+	// README恢复为之前的版本时, 更新该版本的时间使其重新成为最新版本
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "repository_id"}, {Name: "sha"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"etag":         etag,
+			"updated_time": gorm.Expr("current_timestamp"),
+		}),
+	}).Create(&RepositoryReadme{
+		RepositoryID: repository.ID,
+		SHA:          readme.SHA,
+		Path:         readme.Path,
+		Content:      LongText(markdown),
+		Summary:      extractReadmeSummary(markdown),
+		ETag:         etag,
+	}).Error
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type githubRelease struct {
+	ID          int64      `json:"id"`
+	TagName     string     `json:"tag_name"`
+	Name        string     `json:"name"`
+	HtmlURL     string     `json:"html_url"`
+	Draft       bool       `json:"draft"`
+	Prerelease  bool       `json:"prerelease"`
+	PublishedAt *time.Time `json:"published_at"`
+	Assets      []struct {
+		ID int64 `json:"id"`
+	} `json:"assets"`
+}
+
+// getSinceWindow 获取since类型对应的时间窗口长度
+func getSinceWindow(date time.Time, sinceType string) time.Duration {
+	switch sinceType {
+	case Weekly:
+		return time.Hour * 24 * 7
+	case Monthly:
+		return date.AddDate(0, 1, 0).Sub(date)
+	default:
+		return time.Hour * 24
+	}
+}
+
+// findTrendingRelease 查找在Trending记录时间窗口内发布的最新release, 窗口为记录日期前后各一个since周期
+func findTrendingRelease(trending Trending, releases []Release) *Release {
+	window := getSinceWindow(trending.Date, trending.Since)
+	start, end := trending.Date.Add(-window), trending.Date.Add(window)
+	var found *Release
+	for i := range releases {
+		r := &releases[i]
+		if r.PublishedAt == nil || r.PublishedAt.Before(start) || !r.PublishedAt.Before(end) {
+			continue
+		}
+		if found == nil || r.PublishedAt.After(*found.PublishedAt) {
+			found = r
+		}
+	}
+	return found
+}
+
+// releaseEnricher 获取仓库最近的release, 并标记在release发布前后上榜的Trending记录
+type releaseEnricher struct {
+	count int
+}
+
+func (e *releaseEnricher) Name() string {
+	return "releases"
+}
+
+func (e *releaseEnricher) Enrich(gh *GithubClient, db *gorm.DB, repository Repository) error {
+	body, err := gh.Get(fmt.Sprintf("/repos/%s/releases?per_page=%d", repository.FullName, e.count))
+	if err != nil {
+		return err
+	}
+	var githubReleases []githubRelease
+	if err := json.Unmarshal(body, &githubReleases); err != nil {
+		return errors.Wrapf(ErrParse, "unmarshal releases of %s: %s", repository.FullName, err)
+	}
+
+	var releases []Release
+	for _, r := range githubReleases {
+		// 草稿不是公开发布的版本
+		if r.Draft {
+			continue
+		}
+		releases = append(releases, Release{
+			ID:           r.ID,
+			RepositoryID: repository.ID,
+			TagName:      r.TagName,
+			Name:         r.Name,
+			HtmlURL:      r.HtmlURL,
+			PublishedAt:  r.PublishedAt,
+			Prerelease:   r.Prerelease,
+			AssetCount:   len(r.Assets),
+		})
+	}
+	if len(releases) == 0 {
+		return nil
+	}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"tag_name", "name", "html_url", "published_at", "prerelease", "asset_count"}),
+	}).Create(&releases).Error
+	if err != nil {
+		return err
+	}
+	return markTrendingReleases(db, repository.FullName, releases)
+}
+
+// markTrendingReleases 为仓库的Trending记录关联时间窗口内发布的release
+func markTrendingReleases(db *gorm.DB, fullName string, releases []Release) error {
+	oldest := time.Now()
+	for _, r := range releases {
+		if r.PublishedAt != nil && r.PublishedAt.Before(oldest) {
+			oldest = *r.PublishedAt
+		}
+	}
+
+	var trendingList []Trending
+	err := db.Select("id", "date", "since", "release_id").
+		Where("repository = ? AND date >= ?", fullName, oldest.AddDate(0, -1, 0)).
+		Find(&trendingList).Error
+	if err != nil {
+		return err
+	}
+	for _, trending := range trendingList {
+		release := findTrendingRelease(trending, releases)
+		if release == nil || (trending.ReleaseID != nil && *trending.ReleaseID == release.ID) {
+			continue
+		}
+		err := db.Model(&Trending{}).Where("id = ?", trending.ID).Update("release_id", release.ID).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrRateLimited GitHub限流
+	ErrRateLimited = errors.New("github rate limited")
+	// ErrNotFound 请求的页面或仓库不存在
+	ErrNotFound = errors.New("github resource not found")
+	// ErrParse 解析GitHub返回内容失败
+	ErrParse = errors.New("parse github response failed")
+	// ErrRequest 请求失败或返回了非预期的状态码
+	ErrRequest = errors.New("request github failed")
+	// ErrCache 读写缓存失败
+	ErrCache = errors.New("access cache failed")
+	// ErrLocked 任务锁被其他实例持有
+	ErrLocked = errors.New("job is locked by another instance")
+)
+
+// DefaultFailureThreshold 未配置失败比例阈值时使用的默认值
+const DefaultFailureThreshold = 0.5
+
+// statusError 将非200的响应状态码转换为对应的错误
+func statusError(response *http.Response, reqUrl string) error {
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return errors.Wrapf(ErrNotFound, "url: %s", reqUrl)
+	case response.StatusCode == http.StatusTooManyRequests,
+		response.StatusCode == http.StatusForbidden && response.Header.Get("X-RateLimit-Remaining") == "0",
+		response.StatusCode == http.StatusForbidden && response.Header.Get("Retry-After") != "":
+		return errors.Wrapf(ErrRateLimited, "url: %s, status code: %d", reqUrl, response.StatusCode)
+	default:
+		return errors.Wrapf(ErrRequest, "url: %s, status code: %d", reqUrl, response.StatusCode)
+	}
+}
+
+// errorKind 返回错误的类型名称, 用于运行汇总统计
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrParse):
+		return "parse"
+	case errors.Is(err, ErrCache):
+		return "cache"
+	case errors.Is(err, ErrRequest):
+		return "request"
+	default:
+		return "other"
+	}
+}
+
+// RunSummary 记录一次任务运行中成功和失败的数量
+type RunSummary struct {
+	Task      string
+	Since     string
+	Succeeded int
+	// Unchanged 与上次相比没有变化而跳过的数量
+	Unchanged int
+	Failed    map[string]int
+	// Err 导致整个任务失败的错误, 例如写入数据库失败
+	Err error
+}
+
+func NewRunSummary(task, sinceType string) *RunSummary {
+	return &RunSummary{Task: task, Since: sinceType, Failed: make(map[string]int)}
+}
+
+func (s *RunSummary) Success() {
+	s.Succeeded = s.Succeeded + 1
+}
+
+func (s *RunSummary) Skip() {
+	s.Unchanged = s.Unchanged + 1
+}
+
+func (s *RunSummary) Fail(err error) {
+	s.Failed[errorKind(err)] = s.Failed[errorKind(err)] + 1
+}
+
+// Abort 记录导致整个任务失败的错误
+func (s *RunSummary) Abort(err error) {
+	s.Err = err
+}
+
+// Merge 将另一个任务的结果累加到当前汇总中
+func (s *RunSummary) Merge(other *RunSummary) {
+	s.Succeeded = s.Succeeded + other.Succeeded
+	s.Unchanged = s.Unchanged + other.Unchanged
+	for kind, count := range other.Failed {
+		s.Failed[kind] = s.Failed[kind] + count
+	}
+	if s.Err == nil {
+		s.Err = other.Err
+	}
+}
+
+func (s *RunSummary) FailedCount() (count int) {
+	for _, c := range s.Failed {
+		count = count + c
+	}
+	return count
+}
+
+// FailureRatio 失败数量占总数的比例, 没有任何记录时为0
+func (s *RunSummary) FailureRatio() float64 {
+	total := s.Succeeded + s.Unchanged + s.FailedCount()
+	if total == 0 {
+		return 0
+	}
+	return float64(s.FailedCount()) / float64(total)
+}
+
+// Exceeded 判断任务是否应视为失败: 整体出错, 或失败比例超过阈值
+func (s *RunSummary) Exceeded(threshold float64) bool {
+	return s.Err != nil || s.FailureRatio() > threshold
+}
+
+func (s *RunSummary) Log() {
+	fields := log.Fields{
+		"task":          s.Task,
+		"since":         s.Since,
+		"succeeded":     s.Succeeded,
+		"unchanged":     s.Unchanged,
+		"failed":        s.FailedCount(),
+		"failed_detail": s.Failed,
+		"failure_ratio": s.FailureRatio(),
+	}
+	if s.Err != nil {
+		fields["error"] = s.Err.Error()
+		log.WithFields(fields).Error("task run summary")
+		return
+	}
+	log.WithFields(fields).Info("task run summary")
+}
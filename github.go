@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const DefaultGithubApiUrl = "https://api.github.com"
+
+// GithubClient 感知GitHub API限流的客户端, 记录剩余额度, 在额度耗尽或触发二级限流时等待后重试
+type GithubClient struct {
+	client     *http.Client
+	apiUrl     string
+	maxRetries int
+	maxWait    time.Duration
+
+	mu        sync.Mutex
+	limit     int
+	remaining int
+	reset     time.Time
+	requests  int
+}
+
+func NewGithubClient(client *http.Client) *GithubClient {
+	return &GithubClient{
+		client:     client,
+		apiUrl:     Conf.GetGithubApiUrl(),
+		maxRetries: Conf.GetGithubMaxRetries(),
+		maxWait:    Conf.GetGithubMaxWait(),
+		remaining:  -1,
+	}
+}
+
+// Get 请求GitHub API, path为以"/"开头的相对路径, 返回状态码为200的响应内容
+func (g *GithubClient) Get(path string) ([]byte, error) {
+	response, body, err := g.get(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, statusError(response, g.apiUrl+path)
+	}
+	return body, nil
+}
+
+// GetStats 请求GitHub统计接口, 统计数据还在计算中(202)时等待后重试, 没有数据(204)时返回nil
+func (g *GithubClient) GetStats(path string) ([]byte, error) {
+	reqUrl := g.apiUrl + path
+	for attempt := 0; ; attempt++ {
+		response, body, err := g.get(path, nil)
+		if err != nil {
+			return nil, err
+		}
+		switch response.StatusCode {
+		case http.StatusOK:
+			return body, nil
+		case http.StatusNoContent:
+			return nil, nil
+		case http.StatusAccepted:
+			pendingErr := errors.Wrapf(ErrRequest, "stats of %s are still being computed", reqUrl)
+			if attempt >= g.maxRetries {
+				return nil, pendingErr
+			}
+			// GitHub在后台计算统计数据, 等待的时间比普通重试更长
+			g.backoff(attempt, time.Second*time.Duration(5<<attempt), reqUrl, pendingErr)
+		default:
+			return nil, statusError(response, reqUrl)
+		}
+	}
+}
+
+// Post 以POST方式请求完整的GitHub API地址, 用于GraphQL等接口
+func (g *GithubClient) Post(reqUrl string, payload []byte) ([]byte, error) {
+	response, body, err := g.send("POST", reqUrl, payload, map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, statusError(response, reqUrl)
+	}
+	return body, nil
+}
+
+// get 请求GitHub API并附加额外的请求头, 返回状态码为200、202、204或304的响应
+func (g *GithubClient) get(path string, header map[string]string) (*http.Response, []byte, error) {
+	return g.send("GET", g.apiUrl+path, nil, header)
+}
+
+// send 发送请求, 处理限流等待和临时错误重试, 返回状态码为200、202、204或304的响应
+func (g *GithubClient) send(method, reqUrl string, payload []byte, header map[string]string) (response *http.Response, body []byte, err error) {
+	for attempt := 0; ; attempt++ {
+		if err = g.waitForQuota(); err != nil {
+			return nil, nil, err
+		}
+
+		response, body, err = g.do(method, reqUrl, payload, header)
+		if err != nil {
+			// 网络错误按照临时错误重试
+			if attempt >= g.maxRetries {
+				return nil, nil, err
+			}
+			g.backoff(attempt, 0, reqUrl, err)
+			continue
+		}
+		g.updateQuota(response.Header)
+
+		switch {
+		case response.StatusCode == http.StatusOK, response.StatusCode == http.StatusNotModified,
+			response.StatusCode == http.StatusAccepted, response.StatusCode == http.StatusNoContent:
+			return response, body, nil
+		case isRateLimited(response, body):
+			rateErr := errors.Wrapf(ErrRateLimited, "url: %s, status code: %d", reqUrl, response.StatusCode)
+			if attempt >= g.maxRetries {
+				return nil, nil, rateErr
+			}
+			g.backoff(attempt, g.rateLimitWait(response), reqUrl, rateErr)
+		case response.StatusCode >= http.StatusInternalServerError:
+			if attempt >= g.maxRetries {
+				return nil, nil, statusError(response, reqUrl)
+			}
+			g.backoff(attempt, 0, reqUrl, statusError(response, reqUrl))
+		default:
+			log.WithFields(log.Fields{"response_code": response.StatusCode, "body": string(body)}).Debug("请求GitHub API结果异常")
+			return nil, nil, statusError(response, reqUrl)
+		}
+	}
+}
+
+// GetRepository 获取仓库详细信息
+func (g *GithubClient) GetRepository(repo string) (repository Repository, err error) {
+	repository, _, err = g.GetRepositoryIfChanged(repo, "", "")
+	return repository, err
+}
+
+// GetRepositoryIfChanged 使用ETag/Last-Modified发送条件请求获取仓库信息, 仓库未变化时changed为false且不解析响应
+func (g *GithubClient) GetRepositoryIfChanged(repo, etag, lastModified string) (repository Repository, changed bool, err error) {
+	log.WithFields(log.Fields{"repository": repo}).Info("请求仓库")
+	header := make(map[string]string)
+	if etag != "" {
+		header["If-None-Match"] = etag
+	}
+	if lastModified != "" {
+		header["If-Modified-Since"] = lastModified
+	}
+
+	response, body, err := g.get("/repos/"+repo, header)
+	if err != nil {
+		return repository, false, err
+	}
+	if response.StatusCode == http.StatusNotModified {
+		log.WithFields(log.Fields{"repository": repo}).Debug("repository not modified")
+		return repository, false, nil
+	} else if response.StatusCode != http.StatusOK {
+		return repository, false, statusError(response, g.apiUrl+"/repos/"+repo)
+	}
+	if err = json.Unmarshal(body, &repository); err != nil {
+		return repository, false, errors.Wrapf(ErrParse, "unmarshal repository %s: %s", repo, err)
+	}
+	repository.ETag = response.Header.Get("ETag")
+	repository.LastModified = response.Header.Get("Last-Modified")
+	return repository, true, nil
+}
+
+// LogQuota 输出当前的API额度状态
+func (g *GithubClient) LogQuota() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	log.WithFields(log.Fields{
+		"requests":  g.requests,
+		"limit":     g.limit,
+		"remaining": g.remaining,
+		"reset":     g.reset,
+	}).Info("github api quota")
+}
+
+func (g *GithubClient) do(method, reqUrl string, payload []byte, header map[string]string) (*http.Response, []byte, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, reqUrl, reqBody)
+	if err != nil {
+		return nil, nil, errors.Wrapf(ErrRequest, "build request %s: %s", reqUrl, err)
+	}
+	for key, value := range Conf.GetGithubAuthHeader() {
+		req.Header.Add(key, value)
+	}
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+
+	g.mu.Lock()
+	g.requests = g.requests + 1
+	g.mu.Unlock()
+
+	response, err := g.client.Do(req)
+	if err != nil {
+		return nil, nil, errors.Wrapf(ErrRequest, "request %s: %s", reqUrl, err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, nil, errors.Wrapf(ErrRequest, "read response of %s: %s", reqUrl, err)
+	}
+	return response, body, nil
+}
+
+// updateQuota 根据响应头更新剩余额度
+func (g *GithubClient) updateQuota(header http.Header) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit")); err == nil {
+		g.limit = limit
+	}
+	if remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining")); err == nil {
+		g.remaining = remaining
+	}
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		g.reset = time.Unix(reset, 0)
+	}
+	log.WithFields(log.Fields{"limit": g.limit, "remaining": g.remaining, "reset": g.reset}).Debug("github api quota")
+}
+
+// waitForQuota 额度耗尽时等待到重置时间, 等待时间超过maxWait时直接返回限流错误
+func (g *GithubClient) waitForQuota() error {
+	g.mu.Lock()
+	remaining, reset := g.remaining, g.reset
+	g.mu.Unlock()
+	if remaining != 0 {
+		return nil
+	}
+	wait := time.Until(reset)
+	if wait <= 0 {
+		return nil
+	}
+	if wait > g.maxWait {
+		return errors.Wrapf(ErrRateLimited, "quota exhausted until %s", reset)
+	}
+	log.WithFields(log.Fields{"reset": reset, "wait": wait}).Warn("github api quota exhausted, wait until reset")
+	time.Sleep(wait)
+	return nil
+}
+
+// rateLimitWait 获取限流后需要等待的时间, 优先使用Retry-After, 其次是额度重置时间
+func (g *GithubClient) rateLimitWait(response *http.Response) time.Duration {
+	if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if response.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(response.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			if wait := time.Until(time.Unix(reset, 0)); wait > 0 {
+				return wait
+			}
+		}
+	}
+	// 二级限流没有返回等待时间时, GitHub建议至少等待一分钟
+	return time.Minute
+}
+
+// backoff 等待后重试, wait为0时使用带随机抖动的指数退避
+func (g *GithubClient) backoff(attempt int, wait time.Duration, reqUrl string, err error) {
+	if wait <= 0 {
+		wait = time.Second * time.Duration(1<<attempt)
+		wait = wait + time.Duration(rand.Int63n(int64(wait)))
+	}
+	if wait > g.maxWait {
+		wait = g.maxWait
+	}
+	log.WithFields(log.Fields{
+		"url":     reqUrl,
+		"attempt": attempt + 1,
+		"wait":    wait,
+		"error":   err.Error(),
+	}).Warn("request github api failed, retry later")
+	time.Sleep(wait)
+}
+
+// isRateLimited 判断响应是否为限流, 包括额度耗尽和二级限流
+func isRateLimited(response *http.Response, body []byte) bool {
+	if response.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if response.StatusCode != http.StatusForbidden {
+		return false
+	}
+	return response.Header.Get("X-RateLimit-Remaining") == "0" ||
+		response.Header.Get("Retry-After") != "" ||
+		strings.Contains(strings.ToLower(string(body)), "rate limit")
+}
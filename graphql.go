@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// GraphqlBatchSize 单次GraphQL查询的仓库数量
+const GraphqlBatchSize = 50
+
+const graphqlRepositoryFields = `
+fragment RepositoryFields on Repository {
+  databaseId
+  id
+  name
+  nameWithOwner
+  isPrivate
+  url
+  description
+  isFork
+  createdAt
+  updatedAt
+  pushedAt
+  homepageUrl
+  diskUsage
+  stargazerCount
+  forkCount
+  isArchived
+  isDisabled
+  hasIssuesEnabled
+  hasProjectsEnabled
+  hasWikiEnabled
+  visibility
+  primaryLanguage { name }
+  issues(states: OPEN) { totalCount }
+  pullRequests(states: OPEN) { totalCount }
+  watchers { totalCount }
+  licenseInfo { key name spdxId id }
+  repositoryTopics(first: 100) { nodes { topic { name } } }
+  owner {
+    __typename
+    login
+    id
+    avatarUrl
+    url
+    ... on User { databaseId isSiteAdmin }
+    ... on Organization { databaseId }
+  }
+}`
+
+type graphqlRequest struct {
+	Query     string            `json:"query"`
+	Variables map[string]string `json:"variables"`
+}
+
+type graphqlError struct {
+	Type    string        `json:"type"`
+	Path    []interface{} `json:"path"`
+	Message string        `json:"message"`
+}
+
+type graphqlResponse struct {
+	Data   map[string]*graphqlRepository `json:"data"`
+	Errors []graphqlError                `json:"errors"`
+}
+
+type graphqlCount struct {
+	TotalCount int `json:"totalCount"`
+}
+
+type graphqlRepository struct {
+	DatabaseID         int          `json:"databaseId"`
+	ID                 string       `json:"id"`
+	Name               string       `json:"name"`
+	NameWithOwner      string       `json:"nameWithOwner"`
+	IsPrivate          bool         `json:"isPrivate"`
+	URL                string       `json:"url"`
+	Description        string       `json:"description"`
+	IsFork             bool         `json:"isFork"`
+	CreatedAt          *time.Time   `json:"createdAt"`
+	UpdatedAt          *time.Time   `json:"updatedAt"`
+	PushedAt           *time.Time   `json:"pushedAt"`
+	HomepageURL        string       `json:"homepageUrl"`
+	DiskUsage          int          `json:"diskUsage"`
+	StargazerCount     int          `json:"stargazerCount"`
+	ForkCount          int          `json:"forkCount"`
+	IsArchived         bool         `json:"isArchived"`
+	IsDisabled         bool         `json:"isDisabled"`
+	HasIssuesEnabled   bool         `json:"hasIssuesEnabled"`
+	HasProjectsEnabled bool         `json:"hasProjectsEnabled"`
+	HasWikiEnabled     bool         `json:"hasWikiEnabled"`
+	Visibility         string       `json:"visibility"`
+	Issues             graphqlCount `json:"issues"`
+	PullRequests       graphqlCount `json:"pullRequests"`
+	Watchers           graphqlCount `json:"watchers"`
+	PrimaryLanguage    *struct {
+		Name string `json:"name"`
+	} `json:"primaryLanguage"`
+	LicenseInfo *struct {
+		Key    string `json:"key"`
+		Name   string `json:"name"`
+		SpdxID string `json:"spdxId"`
+		ID     string `json:"id"`
+	} `json:"licenseInfo"`
+	RepositoryTopics struct {
+		Nodes []struct {
+			Topic struct {
+				Name string `json:"name"`
+			} `json:"topic"`
+		} `json:"nodes"`
+	} `json:"repositoryTopics"`
+	Owner struct {
+		Typename    string `json:"__typename"`
+		Login       string `json:"login"`
+		ID          string `json:"id"`
+		AvatarURL   string `json:"avatarUrl"`
+		URL         string `json:"url"`
+		DatabaseID  int    `json:"databaseId"`
+		IsSiteAdmin bool   `json:"isSiteAdmin"`
+	} `json:"owner"`
+}
+
+// toRepository 将GraphQL结果转换为与REST API一致的Repository结构
+func (r *graphqlRepository) toRepository(apiUrl string) Repository {
+	repoApi := apiUrl + "/repos/" + r.NameWithOwner
+	repository := Repository{
+		ID:               r.DatabaseID,
+		NodeID:           r.ID,
+		Name:             r.Name,
+		FullName:         r.NameWithOwner,
+		Private:          r.IsPrivate,
+		HtmlURL:          r.URL,
+		Description:      r.Description,
+		Fork:             r.IsFork,
+		URL:              repoApi,
+		ForksURL:         repoApi + "/forks",
+		EventsURL:        repoApi + "/events",
+		LanguagesURL:     repoApi + "/languages",
+		DownloadsURL:     repoApi + "/downloads",
+		CreatedAt:        r.CreatedAt,
+		UpdatedAt:        r.UpdatedAt,
+		PushedAt:         r.PushedAt,
+		GitURL:           "git://" + strings.TrimPrefix(r.URL, "https://") + ".git",
+		CloneURL:         r.URL + ".git",
+		Homepage:         r.HomepageURL,
+		Size:             r.DiskUsage,
+		StargazersCount:  r.StargazerCount,
+		HasIssues:        r.HasIssuesEnabled,
+		HasProjects:      r.HasProjectsEnabled,
+		HasDownloads:     true,
+		HasWiki:          r.HasWikiEnabled,
+		ForksCount:       r.ForkCount,
+		Archived:         r.IsArchived,
+		Disabled:         r.IsDisabled,
+		OpenIssuesCount:  r.Issues.TotalCount + r.PullRequests.TotalCount,
+		Visibility:       strings.ToLower(r.Visibility),
+		SubscribersCount: r.Watchers.TotalCount,
+	}
+	if r.PrimaryLanguage != nil {
+		repository.Language = r.PrimaryLanguage.Name
+	}
+
+	topics := make(StringArray, 0, len(r.RepositoryTopics.Nodes))
+	for _, node := range r.RepositoryTopics.Nodes {
+		topics = append(topics, node.Topic.Name)
+	}
+	repository.Topics = topics
+
+	if r.LicenseInfo != nil {
+		repository.License = &License{
+			Key:    r.LicenseInfo.Key,
+			Name:   r.LicenseInfo.Name,
+			SpdxID: r.LicenseInfo.SpdxID,
+			URL:    apiUrl + "/licenses/" + r.LicenseInfo.Key,
+			NodeID: r.LicenseInfo.ID,
+		}
+	}
+
+	ownerApi := apiUrl + "/users/" + r.Owner.Login
+	repository.Owner = &Owner{
+		ID:        r.Owner.DatabaseID,
+		Login:     r.Owner.Login,
+		NodeID:    r.Owner.ID,
+		AvatarURL: r.Owner.AvatarURL,
+		URL:       ownerApi,
+		HtmlURL:   r.Owner.URL,
+		ReposURL:  ownerApi + "/repos",
+		Type:      r.Owner.Typename,
+		SiteAdmin: r.Owner.IsSiteAdmin,
+	}
+	if r.Owner.Typename == "Organization" {
+		repository.Organization = &Organization{
+			ID:        r.Owner.DatabaseID,
+			Login:     r.Owner.Login,
+			NodeID:    r.Owner.ID,
+			AvatarURL: r.Owner.AvatarURL,
+			HtmlURL:   r.Owner.URL,
+			Type:      r.Owner.Typename,
+		}
+	}
+	return repository
+}
+
+// buildRepositoryQuery 构建批量查询仓库的GraphQL语句, 每个仓库使用r{index}作为别名
+func buildRepositoryQuery(names []string) (graphqlRequest, error) {
+	var params, fields []string
+	variables := make(map[string]string, len(names)*2)
+	for i, name := range names {
+		owner, repo, ok := strings.Cut(name, "/")
+		if !ok {
+			return graphqlRequest{}, errors.Errorf("invalid repository name: %s", name)
+		}
+		params = append(params, fmt.Sprintf("$o%d: String!, $n%d: String!", i, i))
+		fields = append(fields, fmt.Sprintf("  r%d: repository(owner: $o%d, name: $n%d) { ...RepositoryFields }", i, i, i))
+		variables[fmt.Sprintf("o%d", i)] = owner
+		variables[fmt.Sprintf("n%d", i)] = repo
+	}
+	query := fmt.Sprintf("query(%s) {\n%s\n}\n%s", strings.Join(params, ", "), strings.Join(fields, "\n"), graphqlRepositoryFields)
+	return graphqlRequest{Query: query, Variables: variables}, nil
+}
+
+// graphqlErrorKind 将GraphQL返回的错误转换为对应的错误类型
+func graphqlErrorKind(e graphqlError) error {
+	switch e.Type {
+	case "NOT_FOUND":
+		return errors.Wrap(ErrNotFound, e.Message)
+	case "RATE_LIMITED":
+		return errors.Wrap(ErrRateLimited, e.Message)
+	default:
+		return errors.Wrap(ErrRequest, e.Message)
+	}
+}
+
+// graphqlRepositoryFetcher 通过GraphQL API批量获取仓库信息, 每次查询最多GraphqlBatchSize个仓库
+type graphqlRepositoryFetcher struct {
+	gh          *GithubClient
+	endpoint    string
+	concurrency int
+}
+
+// Fetch 将仓库分批后使用固定数量的worker并发查询
+func (f *graphqlRepositoryFetcher) Fetch(names []string, _ map[string]Repository) <-chan repositoryResult {
+	jobs := make(chan []string)
+	results := make(chan repositoryResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < f.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range jobs {
+				for _, result := range f.fetchBatch(batch) {
+					results <- result
+				}
+			}
+		}()
+	}
+
+	go func() {
+		for start := 0; start < len(names); start += GraphqlBatchSize {
+			end := start + GraphqlBatchSize
+			if end > len(names) {
+				end = len(names)
+			}
+			jobs <- names[start:end]
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// fetchBatch 查询一批仓库, 整个请求失败时该批次所有仓库都返回同一个错误
+func (f *graphqlRepositoryFetcher) fetchBatch(names []string) []repositoryResult {
+	results := make([]repositoryResult, len(names))
+	for i, name := range names {
+		results[i].Name = name
+	}
+	fail := func(err error) []repositoryResult {
+		for i := range results {
+			results[i].Err = err
+		}
+		return results
+	}
+
+	log.WithFields(log.Fields{"size": len(names)}).Info("请求仓库(GraphQL)")
+	request, err := buildRepositoryQuery(names)
+	if err != nil {
+		return fail(errors.Wrap(ErrRequest, err.Error()))
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return fail(errors.Wrap(ErrRequest, err.Error()))
+	}
+	body, err := f.gh.Post(f.endpoint, payload)
+	if err != nil {
+		return fail(err)
+	}
+
+	var response graphqlResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fail(errors.Wrapf(ErrParse, "unmarshal graphql response: %s", err))
+	}
+	// 按别名记录每个仓库的错误, 没有path的错误表示整个查询失败
+	aliasErrors := make(map[string]error)
+	for _, e := range response.Errors {
+		if len(e.Path) == 0 {
+			return fail(graphqlErrorKind(e))
+		}
+		if alias, ok := e.Path[0].(string); ok {
+			aliasErrors[alias] = graphqlErrorKind(e)
+		}
+	}
+
+	for i := range results {
+		alias := fmt.Sprintf("r%d", i)
+		if err, ok := aliasErrors[alias]; ok {
+			results[i].Err = err
+			continue
+		}
+		r := response.Data[alias]
+		if r == nil {
+			results[i].Err = errors.Wrapf(ErrNotFound, "repository %s", names[i])
+			continue
+		}
+		results[i].Repository = r.toRepository(f.gh.apiUrl)
+		results[i].Changed = true
+	}
+	return results
+}
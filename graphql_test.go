@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// newTestGraphqlFetcher 创建请求本地GraphQL服务的fetcher, handler收到解析后的请求并返回响应内容
+func newTestGraphqlFetcher(t *testing.T, handler func(request graphqlRequest) string) *graphqlRepositoryFetcher {
+	t.Helper()
+	if Conf == nil {
+		Conf = &Config{}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request graphqlRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("decode graphql request: %s", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(handler(request)))
+	}))
+	t.Cleanup(server.Close)
+
+	gh := &GithubClient{client: server.Client(), apiUrl: "https://api.github.com", remaining: -1}
+	return &graphqlRepositoryFetcher{gh: gh, endpoint: server.URL, concurrency: 1}
+}
+
+func TestGraphqlFetchBatch(t *testing.T) {
+	fetcher := newTestGraphqlFetcher(t, func(request graphqlRequest) string {
+		// 别名rN按names的顺序对应变量oN/nN
+		want := map[string]string{"o0": "alice", "n0": "tool", "o1": "acme", "n1": "lib", "o2": "alice", "n2": "gone"}
+		for key, value := range want {
+			if request.Variables[key] != value {
+				t.Errorf("variable %s = %q, want %q", key, request.Variables[key], value)
+			}
+		}
+		return `{
+  "data": {
+    "r0": {
+      "databaseId": 1, "name": "tool", "nameWithOwner": "alice/tool", "url": "https://github.com/alice/tool",
+      "stargazerCount": 10, "visibility": "PUBLIC",
+      "issues": {"totalCount": 3}, "pullRequests": {"totalCount": 2}, "watchers": {"totalCount": 4},
+      "primaryLanguage": {"name": "Go"},
+      "licenseInfo": {"key": "mit", "name": "MIT License", "spdxId": "MIT", "id": "L1"},
+      "repositoryTopics": {"nodes": [{"topic": {"name": "cli"}}]},
+      "owner": {"__typename": "User", "login": "alice", "id": "U1", "databaseId": 100, "isSiteAdmin": true}
+    },
+    "r1": {
+      "databaseId": 2, "name": "lib", "nameWithOwner": "acme/lib", "url": "https://github.com/acme/lib",
+      "issues": {"totalCount": 0}, "pullRequests": {"totalCount": 5}, "watchers": {"totalCount": 0},
+      "repositoryTopics": {"nodes": []},
+      "owner": {"__typename": "Organization", "login": "acme", "id": "O1", "databaseId": 200}
+    },
+    "r2": null
+  },
+  "errors": [
+    {"type": "NOT_FOUND", "path": ["r2"], "message": "Could not resolve to a Repository with the name 'alice/gone'."}
+  ]
+}`
+	})
+
+	results := fetcher.fetchBatch([]string{"alice/tool", "acme/lib", "alice/gone"})
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	user := results[0]
+	if user.Err != nil || !user.Changed {
+		t.Fatalf("alice/tool: err = %v, changed = %v", user.Err, user.Changed)
+	}
+	if user.Name != "alice/tool" || user.Repository.FullName != "alice/tool" || user.Repository.ID != 1 {
+		t.Errorf("alice/tool mapped to %s (%s, id %d)", user.Name, user.Repository.FullName, user.Repository.ID)
+	}
+	if user.Repository.OpenIssuesCount != 5 {
+		t.Errorf("alice/tool open issues = %d, want issues + pull requests = 5", user.Repository.OpenIssuesCount)
+	}
+	if owner := user.Repository.Owner; owner == nil || owner.ID != 100 || owner.Type != "User" || !owner.SiteAdmin {
+		t.Errorf("alice/tool owner = %+v", owner)
+	}
+	if user.Repository.Organization != nil {
+		t.Errorf("alice/tool should not have an organization, got %+v", user.Repository.Organization)
+	}
+	if license := user.Repository.License; license == nil || license.Key != "mit" {
+		t.Errorf("alice/tool license = %+v", license)
+	}
+	if len(user.Repository.Topics) != 1 || user.Repository.Topics[0] != "cli" || user.Repository.Language != "Go" {
+		t.Errorf("alice/tool topics = %v, language = %s", user.Repository.Topics, user.Repository.Language)
+	}
+
+	org := results[1]
+	if org.Err != nil || org.Name != "acme/lib" || org.Repository.FullName != "acme/lib" {
+		t.Fatalf("acme/lib: name = %s, full name = %s, err = %v", org.Name, org.Repository.FullName, org.Err)
+	}
+	if org.Repository.OpenIssuesCount != 5 {
+		t.Errorf("acme/lib open issues = %d, want 5", org.Repository.OpenIssuesCount)
+	}
+	if owner := org.Repository.Owner; owner == nil || owner.ID != 200 || owner.Type != "Organization" {
+		t.Errorf("acme/lib owner = %+v", owner)
+	}
+	if o := org.Repository.Organization; o == nil || o.ID != 200 || o.Login != "acme" {
+		t.Errorf("acme/lib organization = %+v", o)
+	}
+	if org.Repository.License != nil {
+		t.Errorf("acme/lib should not have a license, got %+v", org.Repository.License)
+	}
+
+	missing := results[2]
+	if missing.Name != "alice/gone" || !errors.Is(missing.Err, ErrNotFound) {
+		t.Errorf("alice/gone: name = %s, err = %v, want ErrNotFound", missing.Name, missing.Err)
+	}
+}
+
+func TestGraphqlFetchBatchQueryError(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     error
+	}{
+		{
+			name:     "rate limited",
+			response: `{"data": null, "errors": [{"type": "RATE_LIMITED", "message": "API rate limit exceeded"}]}`,
+			want:     ErrRateLimited,
+		},
+		{
+			name:     "invalid query",
+			response: `{"errors": [{"message": "Parse error on \"}\""}]}`,
+			want:     ErrRequest,
+		},
+		{
+			name:     "invalid json",
+			response: `not json`,
+			want:     ErrParse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := newTestGraphqlFetcher(t, func(graphqlRequest) string { return tt.response })
+			// 没有path的错误表示整个查询失败, 该批次所有仓库返回同一个错误
+			results := fetcher.fetchBatch([]string{"alice/tool", "acme/lib"})
+			for i, name := range []string{"alice/tool", "acme/lib"} {
+				if results[i].Name != name || !errors.Is(results[i].Err, tt.want) {
+					t.Errorf("result %d: name = %s, err = %v, want %v", i, results[i].Name, results[i].Err, tt.want)
+				}
+			}
+		})
+	}
+}
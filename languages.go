@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antchfx/htmlquery"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AllLanguage 表示不区分语言的Trending页面
+const AllLanguage = "all"
+
+// DiscoverLanguages 语言配置为该值时自动发现GitHub支持的全部语言
+const DiscoverLanguages = "*"
+
+// RedisLanguageCacheKey 语言列表的缓存key, 以hash保存slug和名称
+const RedisLanguageCacheKey = "trending_language_options"
+
+// parseLanguageOptions 解析Trending页面语言下拉框中的语言slug和名称
+func parseLanguageOptions(doc *html.Node) (options []TrendingLanguage) {
+	seen := make(map[string]bool)
+	for _, ele := range htmlquery.Find(doc, "//*[@id='languages-menuitems']//a") {
+		u, err := url.Parse(htmlquery.SelectAttr(ele, "href"))
+		if err != nil {
+			continue
+		}
+		// u.Path已经解码, 例如/trending/c%23解析为c#, 请求时由fetchTrendingPage重新编码
+		slug := strings.TrimPrefix(u.Path, "/trending/")
+		if slug == u.Path || slug == "" || strings.Contains(slug, "/") {
+			continue
+		}
+		slug = strings.ToLower(slug)
+		if seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		options = append(options, TrendingLanguage{
+			Slug: slug,
+			Name: strings.TrimSpace(htmlquery.InnerText(ele)),
+		})
+	}
+	return options
+}
+
+// getGithubLanguages 获取GitHub Trending页面支持的所有语言slug, 优先从缓存读取
+func getGithubLanguages(client *http.Client, db *gorm.DB) []string {
+	ctx := context.Background()
+	rc, err := getCache()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err.Error()}).Error("open cache error")
+	} else if cached, err := rc.HGetAll(ctx, RedisLanguageCacheKey); err != nil {
+		log.WithFields(log.Fields{"key": RedisLanguageCacheKey, "error": err.Error()}).Error("get language cache error")
+	} else if len(cached) > 0 {
+		slugs := make([]string, 0, len(cached))
+		for slug := range cached {
+			slugs = append(slugs, slug)
+		}
+		sort.Strings(slugs)
+		log.WithFields(log.Fields{"size": len(slugs)}).Debug("load github languages from cache")
+		return slugs
+	}
+
+	doc, err := fetchTrendingPage(client, TrendingUrl, Daily, AllLanguage, "")
+	if err != nil {
+		log.WithFields(log.Fields{"error": err.Error()}).Error("get github languages error")
+		return nil
+	}
+	options := parseLanguageOptions(doc)
+	if len(options) == 0 {
+		return nil
+	}
+	slugs := make([]string, 0, len(options))
+	members := make(map[string]string, len(options))
+	for _, option := range options {
+		slugs = append(slugs, option.Slug)
+		members[option.Slug] = option.Name
+	}
+	sort.Strings(slugs)
+
+	// 添加到缓存, 先删除旧的列表, 避免GitHub移除的语言一直保留
+	duration := Conf.GetLanguageCacheTTL()
+	if rc != nil {
+		err := rc.Del(ctx, RedisLanguageCacheKey)
+		if err == nil {
+			err = rc.HSet(ctx, RedisLanguageCacheKey, members, duration)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"key": RedisLanguageCacheKey, "error": err.Error()}).Error("save language cache error")
+		}
+		log.WithFields(log.Fields{"size": len(slugs), "expire": duration}).Info("save github languages to cache.")
+	}
+
+	recordLanguages(db, options)
+	return slugs
+}
+
+// recordLanguages 记录语言首次和最近一次出现的日期, 便于发现GitHub新增的语言
+func recordLanguages(db *gorm.DB, options []TrendingLanguage) {
+	today, _ := time.Parse("2006-01-02", time.Now().In(time.UTC).Format("2006-01-02"))
+
+	var existed []string
+	db.Model(&TrendingLanguage{}).Pluck("slug", &existed)
+	existedMap := make(map[string]bool, len(existed))
+	for _, slug := range existed {
+		existedMap[slug] = true
+	}
+
+	var newLanguages []string
+	for i := range options {
+		options[i].FirstSeen = today
+		options[i].LastSeen = today
+		if !existedMap[options[i].Slug] {
+			newLanguages = append(newLanguages, options[i].Slug)
+		}
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "slug"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "last_seen"}),
+	}).Create(&options).Error
+	if err != nil {
+		log.WithFields(log.Fields{"error": err.Error()}).Error("save github languages to database error")
+		return
+	}
+	// 首次运行时所有语言都是新增的, 不逐个输出
+	if len(existed) > 0 && len(newLanguages) > 0 {
+		log.WithFields(log.Fields{"languages": newLanguages}).Info("found new languages on github trending")
+	}
+}
+
+// validateLanguages 校验语言slug是否为GitHub支持的语言, 返回合法的语言并记录未知的语言
+func validateLanguages(client *http.Client, db *gorm.DB, languages []string) []string {
+	githubLanguages := getGithubLanguages(client, db)
+	if len(githubLanguages) == 0 {
+		log.Warn("get empty language list from github, skip validate languages")
+		return languages
+	}
+	known := make(map[string]bool, len(githubLanguages))
+	for _, slug := range githubLanguages {
+		known[slug] = true
+	}
+
+	var valid, unknown []string
+	for _, language := range languages {
+		slug := strings.ToLower(language)
+		if slug == AllLanguage || known[slug] {
+			valid = append(valid, slug)
+		} else {
+			unknown = append(unknown, language)
+		}
+	}
+	if len(unknown) > 0 {
+		log.WithFields(log.Fields{"unknown": unknown}).Error("found languages not supported by github trending, skip them")
+	}
+	return valid
+}
+
+// discoverLanguages 返回GitHub Trending页面支持的全部语言
+func discoverLanguages(client *http.Client, db *gorm.DB) []string {
+	languages := append([]string{AllLanguage}, getGithubLanguages(client, db)...)
+	log.WithFields(log.Fields{"size": len(languages)}).Info("discover all github trending languages")
+	return languages
+}
+
+// resolveLanguages 获取本次运行需要采集的语言, 命令行指定的语言优先于配置, 配置为"*"时采集全部语言
+func resolveLanguages(client *http.Client, db *gorm.DB, sinceType, flagValue string) []string {
+	var languages []string
+	for _, language := range strings.Split(flagValue, ",") {
+		if language = strings.TrimSpace(language); language != "" {
+			languages = append(languages, language)
+		}
+	}
+	if len(languages) == 0 {
+		languages = Conf.GetLanguages(sinceType)
+	}
+	if len(languages) == 1 && languages[0] == DiscoverLanguages {
+		return discoverLanguages(client, db)
+	}
+	return validateLanguages(client, db, languages)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/htmlquery"
+)
+
+func TestParseLanguageOptions(t *testing.T) {
+	doc, err := htmlquery.Parse(strings.NewReader(`
+<div id="languages-menuitems">
+  <a href="https://github.com/trending/c%23?since=daily">C#</a>
+  <a href="https://github.com/trending/c%2B%2B?since=daily">C++</a>
+  <a href="https://github.com/trending/Go?since=daily"> Go </a>
+  <a href="https://github.com/trending/go?since=weekly">Go</a>
+  <a href="https://github.com/trending/developers/go">Go developers</a>
+</div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := parseLanguageOptions(doc)
+	want := []TrendingLanguage{{Slug: "c#", Name: "C#"}, {Slug: "c++", Name: "C++"}, {Slug: "go", Name: "Go"}}
+	if len(options) != len(want) {
+		t.Fatalf("got %+v, want %+v", options, want)
+	}
+	for i := range want {
+		if options[i].Slug != want[i].Slug || options[i].Name != want[i].Name {
+			t.Errorf("option %d = %s (%s), want %s (%s)", i, options[i].Slug, options[i].Name, want[i].Slug, want[i].Name)
+		}
+	}
+}
+
+func TestFetchTrendingPageEscapesLanguage(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath()+"?"+r.URL.RawQuery)
+		w.Write([]byte("<html></html>"))
+	}))
+	defer server.Close()
+
+	for _, language := range []string{"c#", "c++", "go", AllLanguage} {
+		if _, err := fetchTrendingPage(server.Client(), server.URL+"/trending", Daily, language, "zh"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"/trending/c%23?since=daily&spoken_language_code=zh",
+		"/trending/c++?since=daily&spoken_language_code=zh",
+		"/trending/go?since=daily&spoken_language_code=zh",
+		"/trending?since=daily&spoken_language_code=zh",
+	}
+	if strings.Join(paths, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("requested\n%s\nwant\n%s", strings.Join(paths, "\n"), strings.Join(want, "\n"))
+	}
+}
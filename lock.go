@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// JobLockPrefix 任务锁的key前缀
+const JobLockPrefix = "trending_lock"
+
+// JobLock 跨进程的任务锁, 保证同一个任务同一时间只有一个实例在运行
+type JobLock interface {
+	// TryLock 尝试获取锁, 锁已被其他实例持有时返回false
+	TryLock(ctx context.Context) (bool, error)
+	// Unlock 释放锁和占用的连接, 没有获取到锁时也需要调用
+	Unlock(ctx context.Context) error
+}
+
+// getJobLockKeys 获取任务需要持有的锁, pipeline同时写入Trending和仓库信息, 需要同时持有两个任务的锁
+func getJobLockKeys(task, sinceType string) []string {
+	tasks := []string{task}
+	if task == "pipeline" {
+		tasks = []string{"trending", "repo"}
+	}
+	keys := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		keys = append(keys, JobLockPrefix+"_"+t+"_"+sinceType)
+	}
+	// 按固定顺序加锁, 避免两个实例互相等待
+	sort.Strings(keys)
+	return keys
+}
+
+// newJobLock 根据配置创建任务锁, 使用Redis缓存时使用Redis锁, 否则使用Postgres advisory锁,
+// 都不可用时返回nil
+func newJobLock(store Storage, key string) JobLock {
+	if Conf.GetCacheDriver() == RedisCache {
+		return &redisJobLock{client: getRedisClient(), key: key, ttl: Conf.GetLockTTL()}
+	}
+	if store.DB().Dialector.Name() == PostgresDriver {
+		return &postgresJobLock{store: store, key: key}
+	}
+	return nil
+}
+
+// acquireJobLocks 获取任务需要的所有锁, 锁被其他实例持有时按lock.wait配置等待或返回ErrLocked,
+// 返回的函数用于释放已获取的锁
+func acquireJobLocks(ctx context.Context, store Storage, task, sinceType string) (func(), error) {
+	var locks []JobLock
+	release := func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			if err := locks[i].Unlock(context.Background()); err != nil {
+				log.WithFields(log.Fields{"error": err.Error()}).Error("release job lock error")
+			}
+		}
+	}
+
+	// bolt缓存文件同一时间只能被一个进程打开, 先打开缓存, 被其他进程占用时和任务锁一样等待或退出
+	if Conf.GetCacheDriver() == BoltCache {
+		if err := waitJobLock(ctx, &boltJobLock{}, Conf.GetCachePath()); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range getJobLockKeys(task, sinceType) {
+		lock := newJobLock(store, key)
+		if lock == nil {
+			continue
+		}
+		if err := waitJobLock(ctx, lock, key); err != nil {
+			// 没有获取到的锁同样需要释放连接
+			if unlockErr := lock.Unlock(context.Background()); unlockErr != nil {
+				log.WithFields(log.Fields{"key": key, "error": unlockErr.Error()}).Error("close job lock error")
+			}
+			release()
+			return nil, err
+		}
+		locks = append(locks, lock)
+		log.WithFields(log.Fields{"key": key}).Debug("acquire job lock")
+	}
+	return release, nil
+}
+
+// waitJobLock 获取单个锁, 未开启等待时获取失败直接返回ErrLocked
+func waitJobLock(ctx context.Context, lock JobLock, key string) error {
+	wait := Conf.LockWait
+	deadline := time.Now().Add(Conf.GetLockWaitTimeout())
+	for {
+		ok, err := lock.TryLock(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "acquire job lock %s", key)
+		}
+		if ok {
+			return nil
+		}
+		if !wait || time.Now().After(deadline) {
+			return errors.Wrapf(ErrLocked, "key: %s", key)
+		}
+		log.WithFields(log.Fields{"key": key}).Info("job lock is held by another instance, wait for it")
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ErrLocked, "key: %s, %s", key, ctx.Err())
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// redisUnlockScript 只有锁仍然属于当前实例时才删除
+var redisUnlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// redisRenewScript 只有锁仍然属于当前实例时才续期
+var redisRenewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// redisJobLock 基于Redis SET NX的锁, 持有期间定期续期, 进程异常退出时锁在ttl后自动过期
+type redisJobLock struct {
+	client *redis.Client
+	key    string
+	token  string
+	ttl    time.Duration
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func (l *redisJobLock) TryLock(ctx context.Context) (bool, error) {
+	if l.token == "" {
+		token := make([]byte, 16)
+		if _, err := rand.Read(token); err != nil {
+			return false, err
+		}
+		l.token = hex.EncodeToString(token)
+	}
+	ok, err := l.client.SetNX(ctx, l.key, l.token, l.ttl).Result()
+	if err != nil || !ok {
+		return false, err
+	}
+
+	l.stop = make(chan struct{})
+	l.wg.Add(1)
+	go l.renew()
+	return true, nil
+}
+
+// renew 每隔ttl/3续期一次, 续期失败说明锁已经丢失, 只记录日志
+func (l *redisJobLock) renew() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ret, err := redisRenewScript.Run(context.Background(), l.client, []string{l.key}, l.token, l.ttl.Milliseconds()).Int()
+			if err != nil {
+				log.WithFields(log.Fields{"key": l.key, "error": err.Error()}).Error("renew job lock error")
+			} else if ret == 0 {
+				log.WithFields(log.Fields{"key": l.key}).Error("job lock lost, another instance may run the same task")
+			}
+		}
+	}
+}
+
+func (l *redisJobLock) Unlock(ctx context.Context) error {
+	defer l.client.Close()
+	// 没有获取到锁时只关闭连接
+	if l.stop == nil {
+		return nil
+	}
+	close(l.stop)
+	l.wg.Wait()
+	l.stop = nil
+	return redisUnlockScript.Run(ctx, l.client, []string{l.key}, l.token).Err()
+}
+
+// postgresJobLock 基于Postgres会话级advisory锁, 连接断开时锁自动释放, 不需要续期
+type postgresJobLock struct {
+	store Storage
+	key   string
+	conn  *sql.Conn
+}
+
+// advisoryKey 将锁的名称转换为advisory锁使用的bigint
+func (l *postgresJobLock) advisoryKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(l.key))
+	return int64(h.Sum64())
+}
+
+func (l *postgresJobLock) TryLock(ctx context.Context) (bool, error) {
+	sqlDB, err := l.store.DB().DB()
+	if err != nil {
+		return false, err
+	}
+	// advisory锁属于会话, 需要在同一个连接上加锁和解锁
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.advisoryKey()).Scan(&ok); err != nil {
+		conn.Close()
+		return false, err
+	}
+	if !ok {
+		conn.Close()
+		return false, nil
+	}
+	l.conn = conn
+	return true, nil
+}
+
+func (l *postgresJobLock) Unlock(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+	defer func() {
+		l.conn.Close()
+		l.conn = nil
+	}()
+	_, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.advisoryKey())
+	return err
+}
+
+// boltJobLock 打开bolt缓存文件, 其他进程正在使用时获取失败, 缓存文件在进程退出前一直保持打开
+type boltJobLock struct{}
+
+func (l *boltJobLock) TryLock(context.Context) (bool, error) {
+	_, err := getCache()
+	if errors.Is(err, ErrLocked) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (l *boltJobLock) Unlock(context.Context) error {
+	return nil
+}
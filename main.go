@@ -13,23 +13,25 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/antchfx/htmlquery"
-	"github.com/redis/go-redis/v9"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
-	"gorm.io/gorm"
+	"golang.org/x/net/html"
 )
 
 const TrendingUrl = "https://github.com/trending"
+const TrendingDevelopersUrl = "https://github.com/trending/developers"
 const RedisCachePrefix = "trending"
+const RedisDeveloperCachePrefix = "trending_developers"
 
 const Daily = "daily"
 const Weekly = "weekly"
 const Monthly = "monthly"
 
-var languageList = []string{"all", "c", "c++", "go", "java", "jupyter-notebook", "python", "javascript", "typescript", "rust", "vue"}
+// defaultLanguageList 未在配置中指定语言时默认采集的语言列表
+var defaultLanguageList = []string{"all", "c", "c++", "go", "java", "jupyter-notebook", "python", "javascript", "typescript", "rust", "vue"}
 
 /*
 *
@@ -57,135 +59,273 @@ func getDate(since string) (date string) {
 	return t.Add(-time.Hour * 24 * duration).Format("2006-01-02")
 }
 
-func getTrendingList(client *http.Client, sinceType, language string) (repoList [][2]string) {
+// Contributor Trending卡片中"Built by"展示的贡献者
+type Contributor struct {
+	Login     string `json:"login"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// TrendingItem Trending页面中单个仓库卡片的解析结果
+type TrendingItem struct {
+	Repository  string        `json:"repository"`
+	Description string        `json:"description"`
+	Language    string        `json:"language"`
+	Stars       int           `json:"stars"`
+	Forks       int           `json:"forks"`
+	BuiltBy     []Contributor `json:"built_by"`
+	StarsSince  int           `json:"stars_since"`
+	// Rank 在榜单中的位置, 从1开始
+	Rank int `json:"rank"`
+	// BestRank、FirstSeen、LastSeen 只在Redis缓存中使用, 记录当天的最好名次和首次、最后一次上榜的时间
+	BestRank  int        `json:"best_rank,omitempty"`
+	FirstSeen *time.Time `json:"first_seen,omitempty"`
+	LastSeen  *time.Time `json:"last_seen,omitempty"`
+}
+
+// mergeCacheItem 将本次采集结果与缓存中的记录合并, 保留最大的star数、最好的名次和首次上榜时间
+func mergeCacheItem(item, old TrendingItem, seenAt time.Time) TrendingItem {
+	merged := item
+	merged.BestRank, merged.FirstSeen, merged.LastSeen = item.Rank, &seenAt, &seenAt
+	if old.StarsSince > merged.StarsSince {
+		merged.StarsSince = old.StarsSince
+	}
+	oldBest := old.BestRank
+	if oldBest == 0 {
+		oldBest = old.Rank
+	}
+	if oldBest > 0 && oldBest < merged.BestRank {
+		merged.BestRank = oldBest
+	}
+	if old.FirstSeen != nil && old.FirstSeen.Before(seenAt) {
+		merged.FirstSeen = old.FirstSeen
+	}
+	return merged
+}
+
+// BuiltByLogins 返回贡献者的login列表
+func (item *TrendingItem) BuiltByLogins() []string {
+	logins := make([]string, 0, len(item.BuiltBy))
+	for _, c := range item.BuiltBy {
+		logins = append(logins, c.Login)
+	}
+	return logins
+}
+
+var numberRe = regexp.MustCompile(`[\d,]+`)
+
+// parseNumber 解析页面中类似"12,345"或"123 stars today"的数字, 解析失败返回0
+func parseNumber(s string) int {
+	numStr := strings.ReplaceAll(numberRe.FindString(s), ",", "")
+	if numStr == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(numStr)
+	if err != nil {
+		log.WithFields(log.Fields{"value": s, "error": err.Error()}).Error("str convent to int failue")
+		return 0
+	}
+	return n
+}
+
+// parseTrendingItem 从<article>卡片中解析仓库信息
+func parseTrendingItem(article *html.Node) TrendingItem {
+	var item TrendingItem
+	if repoEle := htmlquery.FindOne(article, "h2/a/@href"); repoEle != nil {
+		item.Repository = strings.TrimPrefix(htmlquery.SelectAttr(repoEle, "href"), "/")
+	}
+	if descEle := htmlquery.FindOne(article, "p"); descEle != nil {
+		item.Description = strings.TrimSpace(htmlquery.InnerText(descEle))
+	}
+	if langEle := htmlquery.FindOne(article, "div//span[@itemprop='programmingLanguage']"); langEle != nil {
+		item.Language = strings.TrimSpace(htmlquery.InnerText(langEle))
+	}
+	if starEle := htmlquery.FindOne(article, "div/a[contains(@href, '/stargazers')]"); starEle != nil {
+		item.Stars = parseNumber(htmlquery.InnerText(starEle))
+	}
+	if forkEle := htmlquery.FindOne(article, "div/a[contains(@href, '/forks')]"); forkEle != nil {
+		item.Forks = parseNumber(htmlquery.InnerText(forkEle))
+	}
+	for _, avatarEle := range htmlquery.Find(article, "div/span//a/img[contains(@class, 'avatar')]") {
+		item.BuiltBy = append(item.BuiltBy, Contributor{
+			Login:     strings.TrimPrefix(htmlquery.SelectAttr(avatarEle, "alt"), "@"),
+			AvatarURL: htmlquery.SelectAttr(avatarEle, "src"),
+		})
+	}
+	if sinceEle := htmlquery.FindOne(article, "div/span[last()]"); sinceEle != nil {
+		item.StarsSince = parseNumber(strings.TrimSpace(htmlquery.InnerText(sinceEle)))
+	}
+	return item
+}
+
+// fetchTrendingPage 请求Trending页面并解析为html文档, pageUrl为不含语言的页面地址, language为未编码的slug(例如c#),
+// spokenLanguage为空时不过滤
+func fetchTrendingPage(client *http.Client, pageUrl, sinceType, language, spokenLanguage string) (*html.Node, error) {
 	var reqUrl string
 	if language == "" {
-		panic("language type can't be empty!")
-	} else if strings.ToLower(language) == "all" {
-		reqUrl = TrendingUrl
+		return nil, errors.New("language type can't be empty")
+	} else if strings.ToLower(language) == AllLanguage {
+		reqUrl = pageUrl
 	} else {
-		reqUrl = TrendingUrl + "/" + language
+		reqUrl = pageUrl + "/" + url.PathEscape(language)
 	}
 
 	log.Info("开始请求" + reqUrl)
 	request, err := http.NewRequest("GET", reqUrl, nil)
+	if err != nil {
+		return nil, errors.Wrapf(ErrRequest, "build request %s: %s", reqUrl, err)
+	}
 	query := request.URL.Query()
-	query.Add("sinceType", sinceType)
+	query.Add("since", sinceType)
+	if spokenLanguage != "" {
+		query.Add("spoken_language_code", spokenLanguage)
+	}
 	request.URL.RawQuery = query.Encode()
 
-	if err != nil {
-		panic(err)
-	}
 	r, err := client.Do(request)
 	log.Debug("请求完成" + reqUrl)
-
 	if err != nil {
-		panic(err)
+		return nil, errors.Wrapf(ErrRequest, "request %s: %s", reqUrl, err)
 	}
-	bodyReader := r.Body
+	defer r.Body.Close()
 
 	if r.StatusCode != 200 {
-		log.WithFields(log.Fields{"url": reqUrl}).Fatalf("请求GitHub treading列表状态码异常")
+		return nil, statusError(r, reqUrl)
 	}
 	log.Info("请求Github成功")
 
-	body, err := io.ReadAll(bodyReader)
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.WithFields(log.Fields{"error": err.Error()}).Fatalf("读取Github返回结果失败")
+		return nil, errors.Wrapf(ErrRequest, "read response of %s: %s", reqUrl, err)
 	}
 	doc, err := htmlquery.Parse(strings.NewReader(string(body)))
 	if err != nil {
-		log.WithFields(log.Fields{"error": err.Error()}).Fatalf("解析Github Treading网也内容失败")
+		return nil, errors.Wrapf(ErrParse, "parse html of %s: %s", reqUrl, err)
 	}
-	re := regexp.MustCompile(`\d+`)
-	articles := htmlquery.Find(doc, "//article")
-	for _, article := range articles {
-		repoEle := htmlquery.FindOne(article, "h2/a/@href")
-		startEle := htmlquery.FindOne(article, "div/span[last()]")
-		repoStr := htmlquery.SelectAttr(repoEle, "href")
-		repoStr = strings.TrimPrefix(repoStr, "/")
-		startStr := htmlquery.InnerText(startEle)
-		startStr = strings.TrimSpace(startStr)
-		startStr = re.FindString(startStr)
+	return doc, nil
+}
 
-		repoList = append(repoList, [2]string{repoStr, startStr})
+func getTrendingList(client *http.Client, sinceType, language, spokenLanguage string) (repoList []TrendingItem, err error) {
+	doc, err := fetchTrendingPage(client, TrendingUrl, sinceType, language, spokenLanguage)
+	if err != nil {
+		return nil, err
+	}
+	articles := htmlquery.Find(doc, "//article")
+	// 没有仓库卡片且不是GitHub的空列表提示时, 说明页面结构发生了变化
+	if len(articles) == 0 && htmlquery.FindOne(doc, "//*[contains(@class, 'blankslate')]") == nil {
+		return nil, errors.Wrapf(ErrParse, "no trending article found, language: %s", language)
+	}
+	for i, article := range articles {
+		item := parseTrendingItem(article)
+		item.Rank = i + 1
+		if item.Repository == "" {
+			log.Warn("skip trending article without repository link")
+			continue
+		}
+		repoList = append(repoList, item)
 	}
 
-	return repoList
+	return repoList, nil
 }
 
-func getRepositryInfo(client *http.Client, repo string) (repository Repository, err error) {
-	repoApi := "https://api.github.com/repos/" + repo
-	log.WithFields(log.Fields{"url": repoApi}).Info("请求仓库")
-
-	// 1. 构建请求
-	req, err := http.NewRequest("GET", repoApi, nil)
-	if err != nil {
-		log.WithFields(log.Fields{"error": err.Error()}).Fatal("创建Http请求失败")
+// getCacheDuration 获取不同since类型的Redis缓存过期时间
+func getCacheDuration(sinceType string) (duration time.Duration) {
+	switch sinceType {
+	case Daily:
+		duration = time.Hour * 24 * 2
+	case Weekly:
+		duration = time.Hour * 24 * 8
+	case Monthly:
+		duration = time.Hour * 24 * 32
 	}
-	headers := Conf.GetGithubAuthHeader()
-	for key, value := range headers {
-		req.Header.Add(key, value)
+	return duration
+}
+
+// trendingScope Trending页面的筛选条件, 即编程语言和自然语言
+type trendingScope struct {
+	Language       string
+	SpokenLanguage string
+}
+
+// getTrendingScopes 返回编程语言和自然语言的组合列表
+func getTrendingScopes(languages []string) []trendingScope {
+	spokenLanguages := Conf.GetSpokenLanguages()
+	scopes := make([]trendingScope, 0, len(languages)*len(spokenLanguages))
+	for _, language := range languages {
+		for _, spokenLanguage := range spokenLanguages {
+			scopes = append(scopes, trendingScope{Language: language, SpokenLanguage: spokenLanguage})
+		}
 	}
+	return scopes
+}
 
-	// 2. 开始请求
-	response, err := client.Do(req)
-	if err != nil {
-		log.WithFields(
-			log.Fields{
-				"repository": repoApi,
-				"error":      err.Error(),
-			}).Error("request github api get error")
-		return repository, err
+// getTrendingCacheKey 获取Trending仓库的Redis缓存key, 不区分自然语言时沿用原有的key格式
+func getTrendingCacheKey(sinceType string, scope trendingScope, date string) string {
+	if scope.SpokenLanguage == "" {
+		return RedisCachePrefix + "_" + sinceType + "_" + scope.Language + "_" + date
 	}
+	return RedisCachePrefix + "_" + sinceType + "_" + scope.Language + "_" + scope.SpokenLanguage + "_" + date
+}
 
-	// 3. 处理结果
-	bodyByte, err := io.ReadAll(response.Body)
-	if err != nil {
-		log.WithFields(
-			log.Fields{"repository": repoApi, "error": err.Error()},
-		).Error("read github api result bytes error")
-		return repository, err
+// parseCacheItem 解析Redis hash中缓存的仓库信息, 兼容旧版本只缓存star数字的格式
+func parseCacheItem(value string) (item TrendingItem, err error) {
+	if err = json.Unmarshal([]byte(value), &item); err == nil {
+		return item, nil
 	}
-	if response.StatusCode != 200 {
-		log.WithFields(log.Fields{"response_code": response.StatusCode})
-		log.Info("response body: %s" + string(bodyByte))
-		log.WithFields(log.Fields{"request_url": repoApi}).Fatal("请求GitHub仓库结果异常")
+	star, convErr := strconv.Atoi(value)
+	if convErr != nil {
+		return item, err
 	}
-
-	// 4. 序列化成结构体
-	err = json.Unmarshal(bodyByte, &repository)
-	if err != nil {
-		log.WithFields(
-			log.Fields{
-				"repository": repoApi,
-				"error":      err.Error(),
-			},
-		).Error("Unmarshal body error")
-		return repository, err
-	}
-	return repository, nil
+	item.StarsSince = star
+	return item, nil
 }
 
-// 保存到数据库
-func saveTrendingList(client *http.Client, db *gorm.DB, sinceType string) {
+// saveTrendingList 采集Trending并保存到缓存和数据库, 返回本次采集到的仓库名称
+func saveTrendingList(client *http.Client, store Storage, sinceType string, languages []string) (*RunSummary, []string) {
+	db := store.DB()
 	ctx := context.Background()
-	rc := getRedisClient()
-	var repoMaps = make(map[string][][2]string)
+	summary := NewRunSummary("trending", sinceType)
+	rc, err := getCache()
+	if err != nil {
+		summary.Abort(err)
+		return summary, nil
+	}
+	var repoMaps = make(map[trendingScope][]TrendingItem)
 
-	for _, language := range languageList {
-		repoList := getTrendingList(client, sinceType, language)
+	for _, scope := range getTrendingScopes(languages) {
+		repoList, err := getTrendingList(client, sinceType, scope.Language, scope.SpokenLanguage)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"language":        scope.Language,
+				"spoken_language": scope.SpokenLanguage,
+				"error":           err.Error(),
+			}).Error("get trending list error, skip this language")
+			summary.Fail(err)
+			continue
+		}
 		if l := len(repoList); l > 0 {
-			repoMaps[language] = repoList
+			repoMaps[scope] = repoList
 		}
 	}
 
 	if l := len(repoMaps); l == 0 {
-		log.WithFields(log.Fields{"repo_list_length": l})
-		syscall.Exit(1)
+		log.WithFields(log.Fields{"repo_list_length": l}).Error("no trending repository collected")
+		return summary, nil
+	}
+	// 本次采集到的仓库, 同一个仓库只返回一次
+	var names []string
+	nameSet := make(map[string]bool)
+	for _, repoList := range repoMaps {
+		for _, item := range repoList {
+			if !nameSet[item.Repository] {
+				nameSet[item.Repository] = true
+				names = append(names, item.Repository)
+			}
+		}
 	}
+
 	var (
 		trendingList   []Trending
+		observations   []TrendingObservation
 		trendRecords   []Trending
 		trendRecordMap = make(map[string]Trending)
 		created        int
@@ -193,85 +333,110 @@ func saveTrendingList(client *http.Client, db *gorm.DB, sinceType string) {
 		date           time.Time
 	)
 	dateStr := getDate(sinceType)
-	date, err := time.Parse("2006-01-02", dateStr)
+	date, err = time.Parse("2006-01-02", dateStr)
 	log.WithFields(log.Fields{
 		"dateStr": dateStr,
 		"date":    date,
 		"now":     time.Now().In(time.FixedZone("UTC", 8*60*60)),
 	}).Info("get date info")
 	if err != nil {
-		log.WithFields(log.Fields{"date": dateStr}).Error("parse date error")
-		panic(err)
+		summary.Abort(errors.Wrapf(err, "parse date %s", dateStr))
+		return summary, nil
 	}
 
-	db.Select("id", "repository", "language").
-		Where(&Trending{Date: date, Since: sinceType}).
-		Find(&trendRecords)
+	trendRecords, err = store.LoadTrendings(date, sinceType)
+	if err != nil {
+		summary.Abort(err)
+		return summary, nil
+	}
 	for _, r := range trendRecords {
-		key := fmt.Sprintf("%s:%s", r.Language, r.Repository)
+		key := fmt.Sprintf("%s:%s:%s", r.Language, r.SpokenLanguage, r.Repository)
 		trendRecordMap[key] = r
 	}
 
-	for language, repoList := range repoMaps {
+	seenAt := time.Now()
+	for scope, repoList := range repoMaps {
+		language := scope.Language
+		observations = append(observations, newTrendingObservations(sinceType, scope, repoList, seenAt)...)
 		// 获取key对应的所有map数据(即仓库和start信息)
-		redisCacheKey := RedisCachePrefix + "_" + sinceType + "_" + language + "_" + dateStr
-		cacheRet, err := rc.HGetAll(ctx, redisCacheKey).Result()
-		if err == redis.Nil {
+		redisCacheKey := getTrendingCacheKey(sinceType, scope, dateStr)
+		cacheRet, err := rc.HGetAll(ctx, redisCacheKey)
+		if err != nil {
+			log.WithFields(log.Fields{"key": redisCacheKey, "error": err.Error()}).Error("get cache value error, skip this language")
+			summary.Fail(errors.Wrapf(ErrCache, "get %s: %s", redisCacheKey, err))
+			continue
+		} else if len(cacheRet) == 0 {
 			log.WithFields(log.Fields{"key": redisCacheKey}).Debug("the key not has value")
-		} else if err != nil {
-			log.WithFields(log.Fields{"key": redisCacheKey, "error": err.Error()}).Fatal("get redis value error")
 		}
-		var cacheRepoMap = make(map[string]interface{})
+		var cacheRepoMap = make(map[string]string)
 		var obTrendingRecords []*TrendingRecord
 
-		for _, repo := range repoList {
-			// 检查start是否为数字
-			star, err := strconv.Atoi(repo[1])
-			if err != nil {
-				log.WithFields(log.Fields{"start": repo[1], "error": err.Error()}).Error("str convent to int failue")
-			}
-			oldStrStar, state := cacheRet[repo[0]]
-			oldStar, _ := strconv.Atoi(oldStrStar)
-			log.WithFields(log.Fields{"oldStar": oldStar, "newStar": star}).Debug("parse start info to number")
+		for _, item := range repoList {
+			star := item.StarsSince
+			oldValue, state := cacheRet[item.Repository]
 
-			// 比较大小是否存储
+			// 与缓存中的记录合并, star数保留较大值, 名次保留最好的名次
+			cached := mergeCacheItem(item, TrendingItem{}, seenAt)
 			if !state {
-				log.WithFields(log.Fields{"repository": repo[0]}).Debug("repostry not exist, will save to cache")
-			} else if err != nil {
-				log.WithFields(log.Fields{"key": repo[0], "error": err.Error()}).Fatal("get redis value error, skip this repository")
-				continue
-			} else if oldStar > star {
-				log.WithFields(
-					log.Fields{
-						"old_value":  oldStar,
-						"new_value":  star,
-						"repository": repo[0],
-					},
-				).Info("the old value greater than new value, skip this repository")
+				log.WithFields(log.Fields{"repository": item.Repository}).Debug("repostry not exist, will save to cache")
+			} else if oldItem, err := parseCacheItem(oldValue); err != nil {
+				log.WithFields(log.Fields{"key": item.Repository, "error": err.Error()}).Error("parse redis value error, will overwrite it")
+			} else {
+				cached = mergeCacheItem(item, oldItem, seenAt)
+				if oldItem.StarsSince > star {
+					log.WithFields(
+						log.Fields{
+							"old_value":  oldItem.StarsSince,
+							"new_value":  star,
+							"repository": item.Repository,
+						},
+					).Info("the old value greater than new value, keep the old value")
+				}
+			}
+			itemBytes, err := json.Marshal(cached)
+			if err != nil {
+				log.WithFields(log.Fields{"repository": item.Repository, "error": err.Error()}).Error("marshal trending item error")
 				continue
 			}
-			cacheRepoMap[repo[0]] = star
-			log.WithFields(log.Fields{"repoName": repo[0], "star": star}).Debug("add repo pair to cacheRepoMap")
+			cacheRepoMap[item.Repository] = string(itemBytes)
+			log.WithFields(log.Fields{"repoName": item.Repository, "star": star, "rank": item.Rank}).Debug("add repo pair to cacheRepoMap")
+			builtBy := StringArray(item.BuiltByLogins())
 			obTr := &TrendingRecord{
-				Date:       dateStr,
-				Repository: repo[0],
-				Stars:      star,
-				Since:      sinceType,
-				Language:   language,
+				Date:           dateStr,
+				Repository:     item.Repository,
+				Stars:          star,
+				Since:          sinceType,
+				Language:       language,
+				SpokenLanguage: scope.SpokenLanguage,
+				Description:    item.Description,
+				RepoLanguage:   item.Language,
+				TotalStars:     item.Stars,
+				Forks:          item.Forks,
+				BuiltBy:        item.BuiltBy,
+				Rank:           item.Rank,
+				BestRank:       cached.BestRank,
 			}
-			key := fmt.Sprintf("%s:%s", language, repo[0])
+			key := fmt.Sprintf("%s:%s:%s", language, scope.SpokenLanguage, item.Repository)
 			tempTrending := Trending{
-				Date:       date,
-				Repository: repo[0],
-				Stars:      star,
-				Since:      sinceType,
-				Language:   language,
+				Date:           date,
+				Repository:     item.Repository,
+				Stars:          cached.StarsSince,
+				Since:          sinceType,
+				Language:       language,
+				SpokenLanguage: scope.SpokenLanguage,
+				Description:    item.Description,
+				RepoLanguage:   item.Language,
+				TotalStars:     item.Stars,
+				Forks:          item.Forks,
+				BuiltBy:        builtBy,
+				Rank:           cached.BestRank,
+				FirstSeenAt:    cached.FirstSeen,
+				LastSeenAt:     cached.LastSeen,
 			}
 			if trend, ok := trendRecordMap[key]; !ok {
 				created = created + 1
 				obTr.Action = "create"
 			} else {
-				tempTrending.ID = trend.ID
 				update = update + 1
 				obTr.Action = "update"
 				obTr.RepoId = trend.ID
@@ -283,8 +448,9 @@ func saveTrendingList(client *http.Client, db *gorm.DB, sinceType string) {
 		// 推送到OpenObserve
 		EmitMessage(obTrendingRecords)
 
-		// 添加到redis缓存
-		err = rc.HSet(ctx, redisCacheKey, cacheRepoMap).Err()
+		// 添加到缓存
+		duration := getCacheDuration(sinceType)
+		err = rc.HSet(ctx, redisCacheKey, cacheRepoMap, duration)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"redis_cache_key": redisCacheKey,
@@ -294,70 +460,211 @@ func saveTrendingList(client *http.Client, db *gorm.DB, sinceType string) {
 			"size":    len(cacheRepoMap),
 			"key":     redisCacheKey,
 			"created": created,
-			"update":  update},
-		).Info("add repo pairs to redis cache")
-		var duration time.Duration
-		switch sinceType {
-		case Daily:
-			duration = time.Hour * 24 * 2
-		case Weekly:
-			duration = time.Hour * 24 * 8
-		case Monthly:
-			duration = time.Hour * 24 * 32
-		}
-		rc.Expire(ctx, redisCacheKey, duration)
-		log.WithFields(log.Fields{
-			"size":   len(cacheRepoMap),
-			"expire": duration,
-		}).Info("save repository to redis.")
+			"update":  update,
+			"expire":  duration},
+		).Info("save repository to cache.")
+		summary.Success()
+	}
+
+	// 每次采集都保存观测记录, 失败不影响Trending记录的保存
+	if err := saveTrendingObservations(db, observations, Conf.GetObservationRetention()); err != nil {
+		log.WithFields(log.Fields{"size": len(observations), "error": err.Error()}).Error("save trending observations error")
 	}
 
 	// 添加到数据库
-	db.Save(&trendingList)
+	if len(trendingList) == 0 {
+		return summary, names
+	}
+	if err := store.UpsertTrendings(trendingList); err != nil {
+		summary.Abort(errors.Wrap(err, "save trending list"))
+		return summary, nil
+	}
 	log.WithFields(log.Fields{"created": created, "update": update}).Info("save all trending repositry successful!")
+	return summary, names
 }
 
-func saveRepositry2DB(client *http.Client, db *gorm.DB, sinceType string) {
+// getCachedRepositoryNames 汇总所有语言缓存中的仓库名称, 同一个仓库只返回一次
+func getCachedRepositoryNames(sinceType string, languages []string, summary *RunSummary) (names []string) {
 	ctx := context.Background()
-	rc := getRedisClient()
 	date := getDate(sinceType)
+	rc, err := getCache()
+	if err != nil {
+		summary.Abort(err)
+		return nil
+	}
 
-	for _, language := range languageList {
-		redisCacheKey := RedisCachePrefix + "_" + sinceType + "_" + language + "_" + date
+	nameSet := make(map[string]bool)
+	for _, scope := range getTrendingScopes(languages) {
+		redisCacheKey := getTrendingCacheKey(sinceType, scope, date)
 
-		ret, err := rc.HGetAll(ctx, redisCacheKey).Result()
+		ret, err := rc.HGetAll(ctx, redisCacheKey)
 		if err != nil {
-			log.WithFields(log.Fields{"error": err.Error()}).Fatal("get redis cache error: ")
+			log.WithFields(log.Fields{"key": redisCacheKey, "error": err.Error()}).Error("get cache error, skip this language")
+			summary.Fail(errors.Wrapf(ErrCache, "get %s: %s", redisCacheKey, err))
+			continue
 		}
 
-		if ret == nil || len(ret) == 0 {
-			log.WithFields(log.Fields{"key": redisCacheKey}).Error("get empty repo pair form redis")
+		if len(ret) == 0 {
+			log.WithFields(log.Fields{"key": redisCacheKey}).Error("get empty repo pair form cache")
 			continue
 		}
-
-		var repositoryList []Repository
 		for key := range ret {
-			r, err := getRepositryInfo(client, key)
-			if err != nil {
-				log.WithFields(log.Fields{"name": key, "error": err.Error()}).Error("获取repository详细信息失败")
-				continue
+			if !nameSet[key] {
+				nameSet[key] = true
+				names = append(names, key)
 			}
-			repositoryList = append(repositoryList, r)
 		}
-		db.Save(&repositoryList)
-		log.WithFields(log.Fields{
-			"repositrySize": len(repositoryList),
-		}).Info("save repositry list to database successful")
 	}
+	return names
+}
+
+func saveRepositry2DB(client *http.Client, store Storage, sinceType string, languages []string) *RunSummary {
+	summary := NewRunSummary("repo", sinceType)
+
+	// 1. 汇总所有语言中的仓库, 同一个仓库只获取一次
+	names := getCachedRepositoryNames(sinceType, languages, summary)
+	if len(names) == 0 {
+		return summary
+	}
+	saveRepositoryInfo(client, store, names, summary)
+	return summary
+}
+
+// saveRepositoryInfo 获取仓库详细信息和附加信息并保存, 结果记录在summary中
+func saveRepositoryInfo(client *http.Client, store Storage, names []string, summary *RunSummary) {
+	db := store.DB()
+	gh := NewGithubClient(client)
+	defer gh.LogQuota()
+
+	// 2. 获取已保存仓库的ETag和统计数据, 用于发送条件请求以及为未变化的仓库生成快照
+	var savedRepositories []Repository
+	err := db.Select("id", "full_name", "etag", "last_modified",
+		"stargazers_count", "forks_count", "open_issues_count", "subscribers_count", "size").
+		Where("full_name IN ?", names).
+		Find(&savedRepositories).Error
+	if err != nil {
+		log.WithFields(log.Fields{"error": err.Error()}).Error("load repository etag error")
+	}
+	savedMap := make(map[string]Repository, len(savedRepositories))
+	for _, r := range savedRepositories {
+		savedMap[r.FullName] = r
+	}
+
+	// 3. 并发获取仓库信息并分批保存
+	concurrency, batchSize := Conf.GetGithubConcurrency(), Conf.GetDBBatchSize()
+	log.WithFields(log.Fields{
+		"size":        len(names),
+		"concurrency": concurrency,
+		"batch_size":  batchSize,
+		"fetcher":     Conf.GetGithubFetcher(),
+	}).Info("start fetch repository info")
+
+	// 附加步骤只对有变化的仓库执行
+	enrichers := newRepositoryEnrichers()
+	var repositoryList, unchangedList []Repository
+	saved := 0
+	capturedAt := time.Now()
+	flush := func() {
+		if len(repositoryList) > 0 {
+			if err := store.UpsertRepositories(repositoryList); err != nil {
+				log.WithFields(log.Fields{"size": len(repositoryList), "error": err.Error()}).Error("save repositry list to database error")
+				summary.Abort(errors.Wrap(err, "save repositry list"))
+				repositoryList = nil
+			} else {
+				for range repositoryList {
+					summary.Success()
+				}
+				saved = saved + len(repositoryList)
+				for name, count := range runEnrichers(gh, db, enrichers, repositoryList, concurrency, nil) {
+					log.WithFields(log.Fields{"enricher": name, "failed": count}).Warn("some repositories enrich failed")
+				}
+			}
+		}
+		// 未变化的仓库使用已保存的统计数据生成快照, 保证时间序列连续
+		snapshotList := append(repositoryList, unchangedList...)
+		if err := saveRepositorySnapshots(db, snapshotList, capturedAt); err != nil {
+			log.WithFields(log.Fields{"size": len(snapshotList), "error": err.Error()}).Error("save repository snapshots error")
+		}
+		repositoryList, unchangedList = nil, nil
+	}
+	fetcher := newRepositoryFetcher(gh)
+	for result := range fetcher.Fetch(names, savedMap) {
+		if result.Err != nil {
+			log.WithFields(log.Fields{"name": result.Name, "error": result.Err.Error()}).Error("获取repository详细信息失败")
+			summary.Fail(result.Err)
+			continue
+		}
+		if !result.Changed {
+			summary.Skip()
+			if r, ok := savedMap[result.Name]; ok {
+				unchangedList = append(unchangedList, r)
+			}
+			continue
+		}
+		repositoryList = append(repositoryList, result.Repository)
+		if len(repositoryList)+len(unchangedList) >= batchSize {
+			flush()
+		}
+	}
+	flush()
 
+	log.WithFields(log.Fields{
+		"repositrySize": saved,
+		"unchanged":     summary.Unchanged,
+	}).Info("save repositry list to database successful")
+}
+
+// isCollectTask 判断是否为可以单独运行或定时运行的采集任务
+func isCollectTask(task string) bool {
+	switch task {
+	case "trending", "repo", "developers", "pipeline", "activity":
+		return true
+	}
+	return false
+}
+
+// runTask 获取任务锁和需要采集的语言列表并执行采集任务, task需要先通过isCollectTask检查,
+// 其他实例正在运行同一个任务时返回ErrLocked
+func runTask(ctx context.Context, client *http.Client, store Storage, task, sinceType, languagesName string) (summary *RunSummary, err error) {
+	release, err := acquireJobLocks(ctx, store, task, sinceType)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	db := store.DB()
+	languages := resolveLanguages(client, db, sinceType, languagesName)
+
+	if task == "trending" {
+		log.WithFields(log.Fields{"sinceType": sinceType, "languages": languages}).Info("will run saveTrendingList task .")
+		summary, _ = saveTrendingList(client, store, sinceType, languages)
+	} else if task == "repo" {
+		log.WithFields(log.Fields{"sinceType": sinceType, "languages": languages}).Info("will run saveRepositry2DB task .")
+		summary = saveRepositry2DB(client, store, sinceType, languages)
+	} else if task == "developers" {
+		log.WithFields(log.Fields{"sinceType": sinceType, "languages": languages}).Info("will run saveTrendingDevelopers task .")
+		summary = saveTrendingDevelopers(client, db, sinceType, languages)
+	} else if task == "pipeline" {
+		log.WithFields(log.Fields{"sinceType": sinceType, "languages": languages}).Info("will run runPipeline task .")
+		summary = runPipeline(client, store, sinceType, languages)
+	} else if task == "activity" {
+		log.WithFields(log.Fields{"sinceType": sinceType, "languages": languages}).Info("will run saveRepositoryActivity task .")
+		summary = saveRepositoryActivity(client, db, sinceType, languages)
+	}
+	return summary, nil
 }
 
 func main() {
-	taskName := flag.String("task", "trending", "run collect github trending repositry name task or save repository info task or init database(trending/repo/init_db)")
+	taskName := flag.String("task", "trending", "run collect github trending repositry name task or save repository info task or init database(trending/developers/repo/activity/pipeline/serve/init_db/migrate), migrate accepts up, down or status as argument, e.g. -task migrate up")
 	sinceTypeName := flag.String("since", "daily", "run collect github trending with since params, choice are daily, weekly, monthly")
+	languagesName := flag.String("languages", "", "run with a comma separated subset of languages instead of the configured list, e.g. go,rust, or * for all languages")
 
 	flag.Parse()
 	task, sinceType := *taskName, *sinceTypeName
+	if sinceType != Daily && sinceType != Weekly && sinceType != Monthly {
+		log.WithField("since", sinceType).Error("unknown since type, choice are daily, weekly, monthly")
+		os.Exit(1)
+	}
 	// 1. 初始化配置
 	err := initConfig()
 	if err != nil {
@@ -366,7 +673,8 @@ func main() {
 	}
 
 	// 2. 加载gorm DB
-	db := GetDB()
+	store := GetStorage()
+	db := store.DB()
 
 	// 3. 创建http client
 	tr := &http.Transport{
@@ -383,16 +691,44 @@ func main() {
 		tr.Proxy = http.ProxyURL(proxyUrl)
 	}
 	client := &http.Client{Transport: tr}
-	if task == "trending" {
-		log.WithFields(log.Fields{"sinceType": sinceType}).Info("will run saveTrendingList task .")
-		saveTrendingList(client, db, sinceType)
-	} else if task == "repo" {
-		log.WithFields(log.Fields{"sinceType": sinceType}).Info("will run saveRepositry2DB task .")
-		saveRepositry2DB(client, db, sinceType)
+
+	// 4. 执行任务, 采集类任务会先获取需要采集的语言列表
+	var summary *RunSummary
+	if isCollectTask(task) {
+		summary, err = runTask(context.Background(), client, store, task, sinceType, *languagesName)
+		if errors.Is(err, ErrLocked) {
+			log.WithFields(log.Fields{"task": task, "since": sinceType, "reason": err.Error()}).Warn("another instance is running the same task, exit")
+			return
+		} else if err != nil {
+			log.WithFields(log.Fields{"task": task, "since": sinceType, "error": err.Error()}).Error("run task error")
+			os.Exit(1)
+		}
+	} else if task == "serve" {
+		if err := serve(client, store); err != nil {
+			log.WithFields(log.Fields{"error": err.Error()}).Error("serve error")
+			os.Exit(1)
+		}
 	} else if task == "init_db" {
 		MigrateDB()
+	} else if task == "migrate" {
+		action := MigrateUp
+		if flag.NArg() > 0 {
+			action = flag.Arg(0)
+		}
+		if err := runMigrate(db, action); err != nil {
+			log.WithFields(log.Fields{"action": action, "error": err.Error()}).Error("migrate database error")
+			os.Exit(1)
+		}
 	} else {
 		panic("wrong task type " + task + "!")
 	}
 
+	// 5. 输出运行汇总, 失败比例超过阈值时以非0状态码退出
+	if summary != nil {
+		summary.Log()
+		if threshold := Conf.GetFailureThreshold(); summary.Exceeded(threshold) {
+			log.WithFields(log.Fields{"threshold": threshold}).Error("task failure ratio exceeded threshold")
+			os.Exit(1)
+		}
+	}
 }
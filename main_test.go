@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/htmlquery"
+)
+
+func TestParseTrendingItem(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/trending_article.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		html string
+		want TrendingItem
+	}{
+		{
+			name: "full card",
+			html: string(fixture),
+			want: TrendingItem{
+				Repository:  "alice/tool",
+				Description: "A fast tool for parsing & collecting things",
+				Language:    "Go",
+				Stars:       12345,
+				Forks:       1024,
+				BuiltBy: []Contributor{
+					{Login: "alice", AvatarURL: "https://avatars.githubusercontent.com/u/1001?s=40&v=4"},
+					{Login: "bob", AvatarURL: "https://avatars.githubusercontent.com/u/1002?s=40&v=4"},
+				},
+				StarsSince: 1234,
+			},
+		},
+		{
+			// 没有描述、语言和贡献者的仓库, 最后一个span仍然是本期新增star数
+			name: "minimal card",
+			html: `<article class="Box-row">
+  <div class="float-right d-flex"><a href="/login?return_to=%2Facme%2Fempty">Star</a></div>
+  <h2 class="h3 lh-condensed"><a href="/acme/empty"><span class="text-normal">acme /</span> empty</a></h2>
+  <div class="f6 color-fg-muted mt-2">
+    <a href="/acme/empty/stargazers" class="Link Link--muted d-inline-block mr-3">87</a>
+    <a href="/acme/empty/forks" class="Link Link--muted d-inline-block mr-3">3</a>
+    <span class="d-inline-block float-sm-right">12 stars this week</span>
+  </div>
+</article>`,
+			want: TrendingItem{Repository: "acme/empty", Stars: 87, Forks: 3, StarsSince: 12},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := htmlquery.Parse(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			article := htmlquery.FindOne(doc, "//article")
+			if article == nil {
+				t.Fatal("no article in fixture")
+			}
+			if got := parseTrendingItem(article); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTrendingItem() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// migrationFiles 版本化的数据库迁移脚本, 文件名格式为{version}_{name}.up.sql/{version}_{name}.down.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const (
+	MigrateUp     = "up"
+	MigrateDown   = "down"
+	MigrateStatus = "status"
+)
+
+type migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration 记录已经执行的迁移版本
+type SchemaMigration struct {
+	Version   int64     `gorm:"primaryKey;type:bigint;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(128)"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// loadMigrations 读取内嵌的迁移脚本, 按版本升序返回
+func loadMigrations() ([]migration, error) {
+	return readMigrations(migrationFiles, "migrations")
+}
+
+// readMigrations 读取fsys中dir目录下的迁移脚本, 每个版本必须同时有up和down脚本, 按版本升序返回
+func readMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read migrations")
+	}
+	migrations := make(map[int64]*migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base, direction := strings.TrimSuffix(fileName, ".sql"), ""
+		switch {
+		case strings.HasSuffix(base, ".up"):
+			base, direction = strings.TrimSuffix(base, ".up"), MigrateUp
+		case strings.HasSuffix(base, ".down"):
+			base, direction = strings.TrimSuffix(base, ".down"), MigrateDown
+		default:
+			return nil, errors.Errorf("migration %s must end with .up.sql or .down.sql", fileName)
+		}
+		versionText, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(versionText, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid migration version in %s", fileName)
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, errors.Wrapf(err, "read migration %s", fileName)
+		}
+
+		m, ok := migrations[version]
+		if !ok {
+			m = &migration{Version: version, Name: name}
+			migrations[version] = m
+		} else if m.Name != name {
+			return nil, errors.Errorf("migration version %d has different names: %s, %s", version, m.Name, name)
+		}
+		if direction == MigrateUp {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	list := make([]migration, 0, len(migrations))
+	for _, m := range migrations {
+		if m.Up == "" || m.Down == "" {
+			return nil, errors.Errorf("migration %d_%s must have both up and down scripts", m.Version, m.Name)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// appliedMigrations 返回已经执行的迁移版本, 不存在schema_migrations表时先创建
+func appliedMigrations(db *gorm.DB) (map[int64]SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, errors.Wrap(err, "create schema_migrations")
+	}
+	var list []SchemaMigration
+	if err := db.Order("version").Find(&list).Error; err != nil {
+		return nil, errors.Wrap(err, "load schema_migrations")
+	}
+	applied := make(map[int64]SchemaMigration, len(list))
+	for _, m := range list {
+		applied[m.Version] = m
+	}
+	return applied, nil
+}
+
+// migrateUp 按版本顺序执行所有未执行的迁移, 每个迁移在单独的事务中执行
+func migrateUp(db *gorm.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(m.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return errors.Wrapf(err, "migrate up %d_%s", m.Version, m.Name)
+		}
+		log.WithFields(log.Fields{"version": m.Version, "name": m.Name}).Info("migrate up")
+	}
+	return nil
+}
+
+// migrateDown 回滚最近执行的一个迁移
+func migrateDown(db *gorm.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return errors.Wrapf(err, "migrate down %d_%s", m.Version, m.Name)
+		}
+		log.WithFields(log.Fields{"version": m.Version, "name": m.Name}).Info("migrate down")
+		return nil
+	}
+	log.Info("no migration to roll back")
+	return nil
+}
+
+// migrationStatus 输出每个迁移的执行状态
+func migrationStatus(db *gorm.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		fields := log.Fields{"version": m.Version, "name": m.Name, "status": "pending"}
+		if a, ok := applied[m.Version]; ok {
+			fields["status"] = "applied"
+			fields["applied_at"] = a.AppliedAt
+		}
+		log.WithFields(fields).Info("migration status")
+	}
+	return nil
+}
+
+// runMigrate 执行migrate任务, action为up、down或status, 迁移脚本使用Postgres语法
+func runMigrate(db *gorm.DB, action string) error {
+	if driver := db.Dialector.Name(); driver != PostgresDriver {
+		return errors.Errorf("migrations only support postgres, use -task init_db for %s", driver)
+	}
+	switch action {
+	case MigrateUp:
+		return migrateUp(db)
+	case MigrateDown:
+		return migrateDown(db)
+	case MigrateStatus:
+		return migrationStatus(db)
+	default:
+		return errors.Errorf("unknown migrate action %s, choice are up, down, status", action)
+	}
+}
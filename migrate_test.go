@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations loaded")
+	}
+	for i, m := range migrations {
+		if i > 0 && m.Version <= migrations[i-1].Version {
+			t.Errorf("migration %d_%s is not after %d_%s", m.Version, m.Name, migrations[i-1].Version, migrations[i-1].Name)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d_%s has an empty up or down script", m.Version, m.Name)
+		}
+	}
+}
+
+func TestReadMigrations(t *testing.T) {
+	file := func(content string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(content)} }
+
+	t.Run("pair and sort", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"m/0010_add_index.up.sql":     file("up 10"),
+			"m/0010_add_index.down.sql":   file("down 10"),
+			"m/0002_add_column.down.sql":  file("down 2"),
+			"m/0002_add_column.up.sql":    file("up 2"),
+			"m/0001_init_schema.up.sql":   file("up 1"),
+			"m/0001_init_schema.down.sql": file("down 1"),
+		}
+		migrations, err := readMigrations(fsys, "m")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []migration{
+			{Version: 1, Name: "init_schema", Up: "up 1", Down: "down 1"},
+			{Version: 2, Name: "add_column", Up: "up 2", Down: "down 2"},
+			{Version: 10, Name: "add_index", Up: "up 10", Down: "down 10"},
+		}
+		if len(migrations) != len(want) {
+			t.Fatalf("got %d migrations, want %d", len(migrations), len(want))
+		}
+		for i := range want {
+			if migrations[i] != want[i] {
+				t.Errorf("migration %d = %+v, want %+v", i, migrations[i], want[i])
+			}
+		}
+	})
+
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{
+			name: "missing down",
+			fsys: fstest.MapFS{
+				"m/0001_init_schema.up.sql":   file("up 1"),
+				"m/0001_init_schema.down.sql": file("down 1"),
+				"m/0002_add_column.up.sql":    file("up 2"),
+			},
+			want: "2_add_column must have both up and down scripts",
+		},
+		{
+			name: "missing up",
+			fsys: fstest.MapFS{"m/0001_init_schema.down.sql": file("down 1")},
+			want: "1_init_schema must have both up and down scripts",
+		},
+		{
+			name: "different names",
+			fsys: fstest.MapFS{
+				"m/0001_init_schema.up.sql": file("up 1"),
+				"m/0001_init.down.sql":      file("down 1"),
+			},
+			want: "different names",
+		},
+		{
+			name: "no direction",
+			fsys: fstest.MapFS{"m/0001_init_schema.sql": file("up 1")},
+			want: "must end with .up.sql or .down.sql",
+		},
+		{
+			name: "invalid version",
+			fsys: fstest.MapFS{"m/init_schema.up.sql": file("up 1")},
+			want: "invalid migration version",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readMigrations(tt.fsys, "m")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// newTestPostgresDB 连接TEST_POSTGRES_DSN指定的数据库, 在单独的schema中执行测试, 结束后删除该schema
+func newTestPostgresDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	store, err := openStorage(PostgresDriver, dsn, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := store.DB()
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// search_path只对当前连接生效, 限制为一个连接
+	sqlDB.SetMaxOpenConns(1)
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	if err := db.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("SET search_path TO public")
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		sqlDB.Close()
+	})
+	if err := db.Exec("SET search_path TO " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// assertApplied 检查schema_migrations中已执行的迁移数量
+func assertApplied(t *testing.T, db *gorm.DB, want int) {
+	t.Helper()
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != want {
+		t.Fatalf("applied %d migrations, want %d", len(applied), want)
+	}
+}
+
+// TestMigratePostgres 在空数据库和旧版本init_db创建的数据库上依次执行up、全部down、再次up
+func TestMigratePostgres(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := os.ReadFile("testdata/legacy_init_db.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		setup string
+	}{
+		{name: "fresh"},
+		{name: "legacy init_db", setup: string(legacy)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestPostgresDB(t)
+			if tt.setup != "" {
+				if err := db.Exec(tt.setup).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := runMigrate(db, MigrateUp); err != nil {
+				t.Fatal(err)
+			}
+			assertApplied(t, db, len(migrations))
+			if tt.setup != "" {
+				var trendings []Trending
+				if err := db.Order("date").Find(&trendings).Error; err != nil {
+					t.Fatal(err)
+				}
+				if len(trendings) != 2 || trendings[0].Stars != 8 {
+					t.Errorf("trendings after migrate = %+v, want duplicates removed keeping max stars", trendings)
+				}
+				// 旧版本owners上的外键已删除, 写入不存在的仓库的owner不再失败
+				if err := db.Create(&Owner{ID: 2, Login: "acme", Type: "Organization"}).Error; err != nil {
+					t.Errorf("create owner after migrate: %s", err)
+				}
+				if err := db.Create(&License{Key: "apache-2.0-with-exception", Name: "Apache"}).Error; err != nil {
+					t.Errorf("create license with a long key after migrate: %s", err)
+				}
+			}
+
+			for range migrations {
+				if err := runMigrate(db, MigrateDown); err != nil {
+					t.Fatal(err)
+				}
+			}
+			assertApplied(t, db, 0)
+			if db.Migrator().HasTable("trendings") || db.Migrator().HasTable("repositories") {
+				t.Error("tables still exist after rolling back every migration")
+			}
+
+			if err := runMigrate(db, MigrateUp); err != nil {
+				t.Fatal(err)
+			}
+			assertApplied(t, db, len(migrations))
+		})
+	}
+}
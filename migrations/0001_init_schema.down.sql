@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS trendings;
+DROP TABLE IF EXISTS repositories;
+DROP TABLE IF EXISTS licenses;
+DROP TABLE IF EXISTS organizations;
+DROP TABLE IF EXISTS owners;
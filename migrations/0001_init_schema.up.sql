@@ -0,0 +1,148 @@
+-- 之前通过init_db(AutoMigrate)创建的数据库中表已经存在, CREATE TABLE IF NOT EXISTS不会执行,
+-- 每张表后面通过ADD COLUMN IF NOT EXISTS补齐旧版本没有的列, 约束和索引同样按不存在时创建
+CREATE TABLE IF NOT EXISTS owners (
+    id           bigint PRIMARY KEY,
+    login        varchar(64),
+    node_id      varchar(64),
+    avatar_url   varchar(512),
+    url          varchar(512),
+    html_url     varchar(512),
+    repos_url    varchar(512),
+    type         varchar(32),
+    site_admin   boolean,
+    updated_time timestamptz DEFAULT current_timestamp,
+    deleted_time timestamptz DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id           bigint PRIMARY KEY,
+    login        varchar(64),
+    node_id      varchar(64),
+    avatar_url   varchar(512),
+    html_url     varchar(512),
+    type         varchar(32),
+    site_admin   boolean,
+    updated_time timestamptz DEFAULT current_timestamp,
+    deleted_time timestamptz DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS licenses (
+    key          varchar(64) PRIMARY KEY,
+    name         varchar(64),
+    spdx_id      varchar(64),
+    url          varchar(512),
+    node_id      varchar(64),
+    updated_time timestamptz DEFAULT current_timestamp,
+    deleted_time timestamptz DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS repositories (
+    id                bigint PRIMARY KEY,
+    node_id           varchar(64),
+    name              varchar(64),
+    full_name         varchar(256) NOT NULL,
+    private           boolean,
+    owner_id          bigint,
+    html_url          varchar(512),
+    description       text,
+    fork              boolean,
+    url               varchar(512),
+    forks_url         varchar(256),
+    events_url        varchar(256),
+    languages_url     varchar(256),
+    downloads_url     varchar(256),
+    created_at        timestamptz,
+    updated_at        timestamptz,
+    pushed_at         timestamptz,
+    git_url           varchar(256),
+    clone_url         varchar(256),
+    homepage          varchar(256),
+    size              bigint,
+    stargazers_count  bigint,
+    language          varchar(32),
+    has_issues        boolean,
+    has_projects      boolean,
+    has_downloads     boolean,
+    has_wiki          boolean,
+    has_pages         boolean,
+    forks_count       bigint,
+    archived          boolean,
+    disabled          boolean,
+    open_issues_count bigint,
+    license_key       varchar(64),
+    topics            varchar(32)[],
+    visibility        varchar(32),
+    organization_id   bigint,
+    subscribers_count bigint,
+    etag              varchar(128),
+    last_modified     varchar(64),
+    updated_time      timestamptz DEFAULT current_timestamp,
+    deleted_time      timestamptz DEFAULT NULL,
+    CONSTRAINT fk_repositories_owner FOREIGN KEY (owner_id) REFERENCES owners (id),
+    CONSTRAINT fk_repositories_organization FOREIGN KEY (organization_id) REFERENCES organizations (id),
+    CONSTRAINT fk_repositories_license FOREIGN KEY (license_key) REFERENCES licenses (key)
+);
+ALTER TABLE repositories ADD COLUMN IF NOT EXISTS owner_id bigint;
+ALTER TABLE repositories ADD COLUMN IF NOT EXISTS organization_id bigint;
+ALTER TABLE repositories ADD COLUMN IF NOT EXISTS license_key varchar(64);
+ALTER TABLE repositories ADD COLUMN IF NOT EXISTS etag varchar(128);
+ALTER TABLE repositories ADD COLUMN IF NOT EXISTS last_modified varchar(64);
+
+-- 旧版本的foreignKey:id在owners等表上错误生成了同名外键, 会导致先写入owner时失败
+ALTER TABLE owners DROP CONSTRAINT IF EXISTS fk_repositories_owner;
+ALTER TABLE organizations DROP CONSTRAINT IF EXISTS fk_repositories_organization;
+ALTER TABLE licenses DROP CONSTRAINT IF EXISTS fk_repositories_license;
+-- 旧版本licenses.key为varchar(16)
+ALTER TABLE licenses ALTER COLUMN key TYPE varchar(64);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint
+                   WHERE conrelid = 'repositories'::regclass AND conname = 'fk_repositories_owner') THEN
+        ALTER TABLE repositories
+            ADD CONSTRAINT fk_repositories_owner FOREIGN KEY (owner_id) REFERENCES owners (id);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint
+                   WHERE conrelid = 'repositories'::regclass AND conname = 'fk_repositories_organization') THEN
+        ALTER TABLE repositories
+            ADD CONSTRAINT fk_repositories_organization FOREIGN KEY (organization_id) REFERENCES organizations (id);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint
+                   WHERE conrelid = 'repositories'::regclass AND conname = 'fk_repositories_license') THEN
+        ALTER TABLE repositories
+            ADD CONSTRAINT fk_repositories_license FOREIGN KEY (license_key) REFERENCES licenses (key);
+    END IF;
+END $$;
+
+-- 旧数据没有owner_id, 清空ETag使条件请求失效, 下次运行时会重新获取并写入外键
+UPDATE repositories SET etag = '', last_modified = '' WHERE owner_id IS NULL AND etag <> '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_repositories_full_name ON repositories (full_name);
+CREATE INDEX IF NOT EXISTS idx_repositories_owner_id ON repositories (owner_id);
+CREATE INDEX IF NOT EXISTS idx_repositories_organization_id ON repositories (organization_id);
+CREATE INDEX IF NOT EXISTS idx_repositories_license_key ON repositories (license_key);
+
+CREATE TABLE IF NOT EXISTS trendings (
+    id              bigserial PRIMARY KEY,
+    date            date,
+    repository      varchar(256),
+    stars           integer,
+    since           varchar(16),
+    language        varchar(32),
+    spoken_language varchar(16),
+    description     text,
+    repo_language   varchar(32),
+    total_stars     integer,
+    forks           integer,
+    built_by        varchar(64)[],
+    release_id      bigint,
+    updated_time    timestamptz DEFAULT current_timestamp,
+    deleted_time    timestamptz DEFAULT NULL
+);
+ALTER TABLE trendings ADD COLUMN IF NOT EXISTS spoken_language varchar(16);
+ALTER TABLE trendings ADD COLUMN IF NOT EXISTS description text;
+ALTER TABLE trendings ADD COLUMN IF NOT EXISTS repo_language varchar(32);
+ALTER TABLE trendings ADD COLUMN IF NOT EXISTS total_stars integer;
+ALTER TABLE trendings ADD COLUMN IF NOT EXISTS forks integer;
+ALTER TABLE trendings ADD COLUMN IF NOT EXISTS built_by varchar(64)[];
+ALTER TABLE trendings ADD COLUMN IF NOT EXISTS release_id bigint;
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS repository_commit_activities;
+DROP TABLE IF EXISTS repository_contributors;
+DROP TABLE IF EXISTS releases;
+DROP TABLE IF EXISTS repository_readmes;
+DROP TABLE IF EXISTS repository_languages;
+DROP TABLE IF EXISTS repository_snapshots;
+DROP TABLE IF EXISTS trending_languages;
+DROP TABLE IF EXISTS trending_developers;
@@ -0,0 +1,85 @@
+CREATE TABLE IF NOT EXISTS trending_developers (
+    id                       bigserial PRIMARY KEY,
+    date                     date,
+    login                    varchar(64),
+    name                     varchar(128),
+    avatar_url               varchar(512),
+    popular_repo             varchar(256),
+    popular_repo_description text,
+    since                    varchar(16),
+    language                 varchar(32),
+    updated_time             timestamptz DEFAULT current_timestamp,
+    deleted_time             timestamptz DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS trending_languages (
+    slug         varchar(64) PRIMARY KEY,
+    name         varchar(64),
+    first_seen   date,
+    last_seen    date,
+    updated_time timestamptz DEFAULT current_timestamp,
+    deleted_time timestamptz DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS repository_snapshots (
+    id            bigserial PRIMARY KEY,
+    repository_id bigint NOT NULL,
+    captured_at   timestamptz NOT NULL,
+    stars         integer,
+    forks         integer,
+    open_issues   integer,
+    watchers      integer,
+    size          integer
+);
+CREATE INDEX IF NOT EXISTS idx_repository_snapshot_time ON repository_snapshots (repository_id, captured_at);
+
+CREATE TABLE IF NOT EXISTS repository_languages (
+    repository_id bigint,
+    language      varchar(64),
+    bytes         bigint,
+    updated_time  timestamptz DEFAULT current_timestamp,
+    PRIMARY KEY (repository_id, language)
+);
+
+CREATE TABLE IF NOT EXISTS repository_readmes (
+    repository_id bigint,
+    sha           varchar(64),
+    path          varchar(256),
+    content       text,
+    summary       text,
+    etag          varchar(128),
+    updated_time  timestamptz DEFAULT current_timestamp,
+    PRIMARY KEY (repository_id, sha)
+);
+
+CREATE TABLE IF NOT EXISTS releases (
+    id            bigint PRIMARY KEY,
+    repository_id bigint,
+    tag_name      varchar(256),
+    name          varchar(256),
+    html_url      varchar(512),
+    published_at  timestamptz,
+    prerelease    boolean,
+    asset_count   integer,
+    updated_time  timestamptz DEFAULT current_timestamp
+);
+CREATE INDEX IF NOT EXISTS idx_releases_repository_id ON releases (repository_id);
+
+CREATE TABLE IF NOT EXISTS repository_contributors (
+    repository_id bigint,
+    login         varchar(64),
+    user_id       bigint,
+    avatar_url    varchar(512),
+    type          varchar(32),
+    contributions integer,
+    updated_time  timestamptz DEFAULT current_timestamp,
+    PRIMARY KEY (repository_id, login)
+);
+
+CREATE TABLE IF NOT EXISTS repository_commit_activities (
+    repository_id bigint,
+    week          date,
+    total         integer,
+    updated_time  timestamptz DEFAULT current_timestamp,
+    PRIMARY KEY (repository_id, week)
+);
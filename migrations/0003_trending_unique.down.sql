@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_trending_unique;
+ALTER TABLE trendings ALTER COLUMN spoken_language DROP DEFAULT;
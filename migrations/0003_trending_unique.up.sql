@@ -0,0 +1,16 @@
+-- spoken_language为NULL时唯一索引不生效, 旧数据统一为空字符串
+UPDATE trendings SET spoken_language = '' WHERE spoken_language IS NULL;
+ALTER TABLE trendings ALTER COLUMN spoken_language SET DEFAULT '';
+
+-- 删除并发运行产生的重复记录, 保留stars最大的一条, 并列时保留id最小的一条
+DELETE FROM trendings t
+USING trendings d
+WHERE t.date = d.date
+  AND t.since = d.since
+  AND t.language = d.language
+  AND t.spoken_language = d.spoken_language
+  AND t.repository = d.repository
+  AND (t.stars < d.stars OR (t.stars = d.stars AND t.id > d.id));
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trending_unique
+    ON trendings (date, since, language, spoken_language, repository);
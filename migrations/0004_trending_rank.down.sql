@@ -0,0 +1,3 @@
+ALTER TABLE trendings DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE trendings DROP COLUMN IF EXISTS first_seen_at;
+ALTER TABLE trendings DROP COLUMN IF EXISTS rank;
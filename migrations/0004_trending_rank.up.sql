@@ -0,0 +1,4 @@
+-- rank为当天的最好名次, 旧数据没有名次时为NULL
+ALTER TABLE trendings ADD COLUMN IF NOT EXISTS rank integer;
+ALTER TABLE trendings ADD COLUMN IF NOT EXISTS first_seen_at timestamptz;
+ALTER TABLE trendings ADD COLUMN IF NOT EXISTS last_seen_at timestamptz;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS trending_observations;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS trending_observations (
+    id              bigserial PRIMARY KEY,
+    scraped_at      timestamptz NOT NULL,
+    since           varchar(16),
+    language        varchar(32),
+    spoken_language varchar(16),
+    repository      varchar(256),
+    rank            integer,
+    stars           integer
+);
+CREATE INDEX IF NOT EXISTS idx_trending_observations_scraped_at ON trending_observations (scraped_at);
+CREATE INDEX IF NOT EXISTS idx_trending_observation_repository ON trending_observations (repository);
@@ -5,17 +5,60 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 type Trending struct {
-	ID          int32      `json:"id" gorm:"primaryKey;type:bigserial"`
-	Date        time.Time  `json:"date" gorm:"type:date"`
-	Repository  string     `json:"repository" gorm:"type:varchar(256);foreignKey:full_name"`
-	Stars       int        `json:"stars" gorm:"type:integer"`
-	Since       string     `json:"since" gorm:"type:varchar(16)"`
-	Language    string     `json:"language" gorm:"type:varchar(32)"`
+	ID             int32       `json:"id" gorm:"primaryKey;autoIncrement;size:64"`
+	Date           time.Time   `json:"date" gorm:"type:date;uniqueIndex:idx_trending_unique,priority:1"`
+	Repository     string      `json:"repository" gorm:"type:varchar(256);foreignKey:full_name;uniqueIndex:idx_trending_unique,priority:5"`
+	Stars          int         `json:"stars" gorm:"type:integer"`
+	Since          string      `json:"since" gorm:"type:varchar(16);uniqueIndex:idx_trending_unique,priority:2"`
+	Language       string      `json:"language" gorm:"type:varchar(32);uniqueIndex:idx_trending_unique,priority:3"`
+	SpokenLanguage string      `json:"spoken_language" gorm:"type:varchar(16);uniqueIndex:idx_trending_unique,priority:4"`
+	Description    string      `json:"description" gorm:"type:text"`
+	RepoLanguage   string      `json:"repo_language" gorm:"type:varchar(32)"`
+	TotalStars     int         `json:"total_stars" gorm:"type:integer"`
+	Forks          int         `json:"forks" gorm:"type:integer"`
+	BuiltBy        StringArray `json:"built_by" gorm:"size:64"`
+	ReleaseID      *int64      `json:"release_id" gorm:"type:bigint"`
+	Rank           int         `json:"rank" gorm:"type:integer"`
+	FirstSeenAt    *time.Time  `json:"first_seen_at"`
+	LastSeenAt     *time.Time  `json:"last_seen_at"`
+	UpdatedTime    *time.Time  `json:"update_time" gorm:"default:current_timestamp"`
+	DeletedTime    *time.Time  `json:"delete_time" gorm:"default:null"`
+}
+
+type TrendingObservation struct {
+	ID             int64     `json:"id" gorm:"primaryKey;autoIncrement;size:64"`
+	ScrapedAt      time.Time `json:"scraped_at" gorm:"not null;index"`
+	Since          string    `json:"since" gorm:"type:varchar(16)"`
+	Language       string    `json:"language" gorm:"type:varchar(32)"`
+	SpokenLanguage string    `json:"spoken_language" gorm:"type:varchar(16)"`
+	Repository     string    `json:"repository" gorm:"type:varchar(256);index:idx_trending_observation_repository"`
+	Rank           int       `json:"rank" gorm:"type:integer"`
+	Stars          int       `json:"stars" gorm:"type:integer"`
+}
+
+type TrendingDeveloper struct {
+	ID                     int32      `json:"id" gorm:"primaryKey;autoIncrement;size:64"`
+	Date                   time.Time  `json:"date" gorm:"type:date"`
+	Login                  string     `json:"login" gorm:"type:varchar(64)"`
+	Name                   string     `json:"name" gorm:"type:varchar(128)"`
+	AvatarURL              string     `json:"avatar_url" gorm:"type:varchar(512)"`
+	PopularRepo            string     `json:"popular_repo" gorm:"type:varchar(256)"`
+	PopularRepoDescription string     `json:"popular_repo_description" gorm:"type:text"`
+	Since                  string     `json:"since" gorm:"type:varchar(16)"`
+	Language               string     `json:"language" gorm:"type:varchar(32)"`
+	UpdatedTime            *time.Time `json:"update_time" gorm:"default:current_timestamp"`
+	DeletedTime            *time.Time `json:"delete_time" gorm:"default:null"`
+}
+
+type TrendingLanguage struct {
+	Slug        string     `json:"slug" gorm:"primaryKey;type:varchar(64)"`
+	Name        string     `json:"name" gorm:"type:varchar(64)"`
+	FirstSeen   time.Time  `json:"first_seen" gorm:"type:date"`
+	LastSeen    time.Time  `json:"last_seen" gorm:"type:date"`
 	UpdatedTime *time.Time `json:"update_time" gorm:"default:current_timestamp"`
 	DeletedTime *time.Time `json:"delete_time" gorm:"default:null"`
 }
@@ -26,7 +69,8 @@ type Repository struct {
 	Name             string        `json:"name" gorm:"type:varchar(64)"`
 	FullName         string        `json:"full_name" gorm:"type:varchar(256);not null;uniqueIndex"`
 	Private          bool          `json:"private"`
-	Owner            *Owner        `json:"owner" gorm:"foreignKey:id"`
+	OwnerID          *int          `json:"-" gorm:"type:bigint;index"`
+	Owner            *Owner        `json:"owner" gorm:"foreignKey:OwnerID"`
 	HtmlURL          string        `json:"html_url"  gorm:"type:varchar(512)"`
 	Description      string        `json:"description" gorm:"type:text"`
 	Fork             bool          `json:"fork"`
@@ -35,8 +79,8 @@ type Repository struct {
 	EventsURL        string        `json:"events_url" gorm:"type:varchar(256)"`
 	LanguagesURL     string        `json:"languages_url" gorm:"type:varchar(256)"`
 	DownloadsURL     string        `json:"downloads_url" gorm:"type:varchar(256)"`
-	CreatedAt        *time.Time    `json:"created_at"`
-	UpdatedAt        *time.Time    `json:"updated_at"`
+	CreatedAt        *time.Time    `json:"created_at" gorm:"autoCreateTime:false"`
+	UpdatedAt        *time.Time    `json:"updated_at" gorm:"autoUpdateTime:false"`
 	PushedAt         *time.Time    `json:"pushed_at"`
 	GitURL           string        `json:"git_url" gorm:"type:varchar(256)"`
 	CloneURL         string        `json:"clone_url" gorm:"type:varchar(256)"`
@@ -53,15 +97,76 @@ type Repository struct {
 	Archived         bool          `json:"archived"`
 	Disabled         bool          `json:"disabled"`
 	OpenIssuesCount  int           `json:"open_issues_count"`
-	License          *License      `json:"license" gorm:"foreignKey:key"`
-	Topics           *[]string     `json:"topics" gorm:"type:VARCHAR(32)[]"`
+	LicenseKey       *string       `json:"-" gorm:"type:varchar(64);index"`
+	License          *License      `json:"license" gorm:"foreignKey:LicenseKey;references:Key"`
+	Topics           StringArray   `json:"topics" gorm:"size:32"`
 	Visibility       string        `json:"visibility"  gorm:"type:varchar(32)"`
-	Organization     *Organization `json:"organization" gorm:"foreignKey:id"`
+	OrganizationID   *int          `json:"-" gorm:"type:bigint;index"`
+	Organization     *Organization `json:"organization" gorm:"foreignKey:OrganizationID"`
 	SubscribersCount int           `json:"subscribers_count"`
+	ETag             string        `json:"-" gorm:"column:etag;type:varchar(128)"`
+	LastModified     string        `json:"-" gorm:"type:varchar(64)"`
 	UpdatedTime      *time.Time    `json:"update_time" gorm:"default:current_timestamp"`
 	DeletedTime      *time.Time    `json:"delete_time" gorm:"default:null"`
 }
 
+type RepositorySnapshot struct {
+	ID           int64     `json:"id" gorm:"primaryKey;autoIncrement;size:64"`
+	RepositoryID int       `json:"repository_id" gorm:"type:bigint;not null;index:idx_repository_snapshot_time"`
+	CapturedAt   time.Time `json:"captured_at" gorm:"not null;index:idx_repository_snapshot_time"`
+	Stars        int       `json:"stars" gorm:"type:integer"`
+	Forks        int       `json:"forks" gorm:"type:integer"`
+	OpenIssues   int       `json:"open_issues" gorm:"type:integer"`
+	Watchers     int       `json:"watchers" gorm:"type:integer"`
+	Size         int       `json:"size" gorm:"type:integer"`
+}
+
+type RepositoryLanguage struct {
+	RepositoryID int        `json:"repository_id" gorm:"primaryKey;type:bigint"`
+	Language     string     `json:"language" gorm:"primaryKey;type:varchar(64)"`
+	Bytes        int64      `json:"bytes" gorm:"type:bigint"`
+	UpdatedTime  *time.Time `json:"update_time" gorm:"default:current_timestamp"`
+}
+
+type RepositoryReadme struct {
+	RepositoryID int        `json:"repository_id" gorm:"primaryKey;type:bigint"`
+	SHA          string     `json:"sha" gorm:"primaryKey;column:sha;type:varchar(64)"`
+	Path         string     `json:"path" gorm:"type:varchar(256)"`
+	Content      LongText   `json:"content"`
+	Summary      string     `json:"summary" gorm:"type:text"`
+	ETag         string     `json:"-" gorm:"column:etag;type:varchar(128)"`
+	UpdatedTime  *time.Time `json:"update_time" gorm:"default:current_timestamp"`
+}
+
+type Release struct {
+	ID           int64      `json:"id" gorm:"primaryKey;type:bigint"`
+	RepositoryID int        `json:"repository_id" gorm:"type:bigint;index"`
+	TagName      string     `json:"tag_name" gorm:"type:varchar(256)"`
+	Name         string     `json:"name" gorm:"type:varchar(256)"`
+	HtmlURL      string     `json:"html_url" gorm:"type:varchar(512)"`
+	PublishedAt  *time.Time `json:"published_at"`
+	Prerelease   bool       `json:"prerelease"`
+	AssetCount   int        `json:"asset_count" gorm:"type:integer"`
+	UpdatedTime  *time.Time `json:"update_time" gorm:"default:current_timestamp"`
+}
+
+type RepositoryContributor struct {
+	RepositoryID  int        `json:"repository_id" gorm:"primaryKey;type:bigint"`
+	Login         string     `json:"login" gorm:"primaryKey;type:varchar(64)"`
+	UserID        int        `json:"user_id" gorm:"type:bigint"`
+	AvatarURL     string     `json:"avatar_url" gorm:"type:varchar(512)"`
+	Type          string     `json:"type" gorm:"type:varchar(32)"`
+	Contributions int        `json:"contributions" gorm:"type:integer"`
+	UpdatedTime   *time.Time `json:"update_time" gorm:"default:current_timestamp"`
+}
+
+type RepositoryCommitActivity struct {
+	RepositoryID int        `json:"repository_id" gorm:"primaryKey;type:bigint"`
+	Week         time.Time  `json:"week" gorm:"primaryKey;type:date"`
+	Total        int        `json:"total" gorm:"type:integer"`
+	UpdatedTime  *time.Time `json:"update_time" gorm:"default:current_timestamp"`
+}
+
 type Owner struct {
 	ID          int        `json:"id" gorm:"primaryKey;type:bigint"`
 	Login       string     `json:"login" gorm:"type:varchar(64)"`
@@ -89,7 +194,7 @@ type Organization struct {
 }
 
 type License struct {
-	Key         string     `json:"key" gorm:"primaryKey;type:varchar(16)"`
+	Key         string     `json:"key" gorm:"primaryKey;type:varchar(64)"`
 	Name        string     `json:"name" gorm:"type:varchar(64)"`
 	SpdxID      string     `json:"spdx_id" gorm:"type:varchar(64)"`
 	URL         string     `json:"url" gorm:"type:varchar(512)"`
@@ -98,30 +203,36 @@ type License struct {
 	DeletedTime *time.Time `json:"delete_time" gorm:"default:null"`
 }
 
-var DB *gorm.DB
+var (
+	DB    *gorm.DB
+	Store Storage
+)
 
 func Init() *gorm.DB {
-	dns := Conf.GetDNS()
-	db, err := gorm.Open(postgres.Open(dns), &gorm.Config{
+	store, err := openStorage(Conf.GetDBDriver(), Conf.GetDNS(), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
 	if err != nil {
+		log.WithError(err).Error("open storage error")
 		panic("failed to connect database")
 	}
-	DB = db
+	Store = store
+	DB = store.DB()
 	//MigrateDB()
 
-	return db
+	return DB
 }
 
-func GetDB() *gorm.DB {
-	if DB == nil {
+// GetStorage 获取db.driver配置对应的存储后端
+func GetStorage() Storage {
+	if Store == nil {
 		Init()
 	}
-	return DB
+	return Store
 }
 
 func MigrateDB() {
+	dropLegacyRepositoryConstraints()
 	owner := &Owner{}
 	organization := &Organization{}
 	license := &License{}
@@ -129,15 +240,50 @@ func MigrateDB() {
 		&Repository{
 			Owner:        owner,
 			Organization: organization,
-			Topics:       &[]string{"python"},
+			Topics:       StringArray{"python"},
 			License:      license,
 		},
 		owner,
 		organization,
 		license,
 		&Trending{},
+		&TrendingObservation{},
+		&TrendingDeveloper{},
+		&TrendingLanguage{},
+		&RepositorySnapshot{},
+		&RepositoryLanguage{},
+		&RepositoryReadme{},
+		&Release{},
+		&RepositoryContributor{},
+		&RepositoryCommitActivity{},
 	)
 	if err != nil {
 		log.WithError(err).Fatal("AutoMigrate BD failue")
 	}
+	// 清空没有owner_id的仓库的ETag使条件请求失效, 下次运行时会重新获取并写入外键
+	err = DB.Model(&Repository{}).Where("owner_id IS NULL AND etag <> ''").
+		Updates(map[string]interface{}{"etag": "", "last_modified": ""}).Error
+	if err != nil {
+		log.WithError(err).Fatal("reset repository etag failue")
+	}
+}
+
+// dropLegacyRepositoryConstraints 删除旧版本foreignKey:id在owners等表上错误生成的外键约束
+func dropLegacyRepositoryConstraints() {
+	legacy := []struct {
+		model interface{}
+		name  string
+	}{
+		{&Owner{}, "fk_repositories_owner"},
+		{&Organization{}, "fk_repositories_organization"},
+		{&License{}, "fk_repositories_license"},
+	}
+	for _, c := range legacy {
+		if !DB.Migrator().HasTable(c.model) || !DB.Migrator().HasConstraint(c.model, c.name) {
+			continue
+		}
+		if err := DB.Migrator().DropConstraint(c.model, c.name); err != nil {
+			log.WithFields(log.Fields{"constraint": c.name, "error": err.Error()}).Fatal("drop legacy constraint failue")
+		}
+	}
 }
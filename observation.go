@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// newTrendingObservations 将一次采集的榜单转换为观测记录, Stars为榜单上显示的since周期内新增的star数
+func newTrendingObservations(sinceType string, scope trendingScope, repoList []TrendingItem, scrapedAt time.Time) []TrendingObservation {
+	observations := make([]TrendingObservation, 0, len(repoList))
+	for _, item := range repoList {
+		observations = append(observations, TrendingObservation{
+			ScrapedAt:      scrapedAt,
+			Since:          sinceType,
+			Language:       scope.Language,
+			SpokenLanguage: scope.SpokenLanguage,
+			Repository:     item.Repository,
+			Rank:           item.Rank,
+			Stars:          item.StarsSince,
+		})
+	}
+	return observations
+}
+
+// saveTrendingObservations 保存每次采集的观测记录, 并删除超过保留时长的记录
+func saveTrendingObservations(db *gorm.DB, observations []TrendingObservation, retention time.Duration) error {
+	if len(observations) > 0 {
+		if err := db.CreateInBatches(&observations, Conf.GetDBBatchSize()).Error; err != nil {
+			return errors.Wrap(err, "save trending observations")
+		}
+	}
+	err := db.Where("scraped_at < ?", time.Now().Add(-retention)).Delete(&TrendingObservation{}).Error
+	if err != nil {
+		return errors.Wrap(err, "prune trending observations")
+	}
+	return nil
+}
+
+// GetTrendingObservations 获取仓库在[from, to)时间范围内的观测记录, 按采集时间升序排列, 可以看出仓库当天何时上榜和下榜
+func GetTrendingObservations(db *gorm.DB, fullName string, from, to time.Time) (observations []TrendingObservation, err error) {
+	query := db.Where("repository = ? AND scraped_at >= ?", fullName, from)
+	if !to.IsZero() {
+		query = query.Where("scraped_at < ?", to)
+	}
+	err = query.Order("scraped_at").Find(&observations).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get observations of %s", fullName)
+	}
+	return observations, nil
+}
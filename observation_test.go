@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetTrendingObservations(t *testing.T) {
+	db := newTestDB(t)
+
+	// 保留时长内的观测记录, 使用当前时间附近的值避免被清理
+	base := time.Now().Truncate(time.Hour).Add(-12 * time.Hour)
+	scope := trendingScope{Language: "go"}
+	for i, offset := range []int{3, 0, 2, 1} {
+		list := []TrendingItem{
+			{Repository: "alice/tool", Rank: 10 - i, StarsSince: i},
+			{Repository: "acme/lib", Rank: 1, StarsSince: 100},
+		}
+		observations := newTrendingObservations(Daily, scope, list, base.Add(time.Duration(offset)*time.Hour))
+		if err := saveTrendingObservations(db, observations, 24*time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		from  time.Time
+		to    time.Time
+		hours []int
+		ranks []int
+	}{
+		{name: "open end", from: base, hours: []int{0, 1, 2, 3}, ranks: []int{9, 7, 8, 10}},
+		{name: "to is exclusive", from: base.Add(time.Hour), to: base.Add(3 * time.Hour), hours: []int{1, 2}, ranks: []int{7, 8}},
+		{name: "empty range", from: base.Add(4 * time.Hour), hours: []int{}, ranks: []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observations, err := GetTrendingObservations(db, "alice/tool", tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(observations) != len(tt.hours) {
+				t.Fatalf("got %d observations, want %d", len(observations), len(tt.hours))
+			}
+			for i, o := range observations {
+				want := base.Add(time.Duration(tt.hours[i]) * time.Hour)
+				if o.Repository != "alice/tool" || !o.ScrapedAt.Equal(want) || o.Rank != tt.ranks[i] ||
+					o.Since != Daily || o.Language != "go" {
+					t.Errorf("observation %d = %+v, want alice/tool at %s with rank %d", i, o, want, tt.ranks[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSaveTrendingObservationsRetention(t *testing.T) {
+	db := newTestDB(t)
+
+	now := time.Now()
+	list := []TrendingItem{{Repository: "alice/tool", Rank: 1}}
+	old := newTrendingObservations(Daily, trendingScope{}, list, now.Add(-48*time.Hour))
+	if err := saveTrendingObservations(db, old, 72*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// 再次保存时保留时长缩短为1天, 两天前的记录应被删除
+	if err := saveTrendingObservations(db, newTrendingObservations(Daily, trendingScope{}, list, now), 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	observations, err := GetTrendingObservations(db, "alice/tool", now.Add(-72*time.Hour), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(observations) != 1 || !observations[0].ScrapedAt.Equal(now) {
+		t.Fatalf("got %+v, want only the observation scraped at %s", observations, now)
+	}
+}
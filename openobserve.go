@@ -12,33 +12,77 @@ import (
 )
 
 type TrendingRecord struct {
-	Date       string `json:"date"`
-	Repository string `json:"repository"`
-	Stars      int    `json:"stars"`
-	Since      string `json:"since"`
-	Language   string `json:"language"`
-	Action     string `json:"action"`
-	RepoId     int32  `json:"repoId"`
-	Time       string `json:"_time"`
-	TimeStamp  int64  `json:"_timestamp"`
+	Date           string        `json:"date"`
+	Repository     string        `json:"repository"`
+	Stars          int           `json:"stars"`
+	Since          string        `json:"since"`
+	Language       string        `json:"language"`
+	SpokenLanguage string        `json:"spokenLanguage"`
+	Description    string        `json:"description"`
+	RepoLanguage   string        `json:"repoLanguage"`
+	TotalStars     int           `json:"totalStars"`
+	Forks          int           `json:"forks"`
+	BuiltBy        []Contributor `json:"builtBy"`
+	Rank           int           `json:"rank"`
+	BestRank       int           `json:"bestRank"`
+	Action         string        `json:"action"`
+	RepoId         int32         `json:"repoId"`
+	RecordTime
 }
 
-func fixRecordTime(data []*TrendingRecord) {
+type DeveloperRecord struct {
+	Date                   string `json:"date"`
+	Login                  string `json:"login"`
+	Name                   string `json:"name"`
+	AvatarURL              string `json:"avatarUrl"`
+	PopularRepo            string `json:"popularRepo"`
+	PopularRepoDescription string `json:"popularRepoDescription"`
+	Since                  string `json:"since"`
+	Language               string `json:"language"`
+	Action                 string `json:"action"`
+	DeveloperId            int32  `json:"developerId"`
+	RecordTime
+}
+
+// RecordTime OpenObserve记录的时间字段
+type RecordTime struct {
+	Time      string `json:"_time"`
+	TimeStamp int64  `json:"_timestamp"`
+}
+
+func (r *RecordTime) fixTime(now time.Time) {
+	if r.Time == "" {
+		t := now.In(time.FixedZone("GMT", 8*3600))
+		r.Time = t.Format(time.RFC3339)
+	}
+	if r.TimeStamp <= 0 {
+		t := now.In(time.UTC)
+		r.TimeStamp = t.UnixMicro()
+	}
+}
+
+type timedRecord interface {
+	fixTime(now time.Time)
+}
+
+func fixRecordTime[T timedRecord](data []T) {
 	now := time.Now()
 	for _, record := range data {
-		if record.Time == "" {
-			t := now.In(time.FixedZone("GMT", 8*3600))
-			record.Time = t.Format(time.RFC3339)
-		}
-		if record.TimeStamp <= 0 {
-			t := now.In(time.UTC)
-			record.TimeStamp = t.UnixMicro()
-		}
+		record.fixTime(now)
 	}
 }
 
 // EmitMessage 发送记录的Trending到OpenObserve
 func EmitMessage(data []*TrendingRecord) {
+	emitRecords(Conf.OpenObserve.IndexName, data)
+}
+
+// EmitDeveloperMessage 发送记录的Trending developers到OpenObserve
+func EmitDeveloperMessage(data []*DeveloperRecord) {
+	emitRecords(Conf.OpenObserve.GetDeveloperIndexName(), data)
+}
+
+func emitRecords[T timedRecord](indexName string, data []T) {
 	fixRecordTime(data)
 	dataBytes, err := json.Marshal(data)
 	if err != nil {
@@ -51,18 +95,20 @@ func EmitMessage(data []*TrendingRecord) {
 		Conf.OpenObserve.Protocol,
 		Conf.OpenObserve.Entrypoint,
 		Conf.OpenObserve.Organization,
-		Conf.OpenObserve.IndexName,
+		indexName,
 	)
 	req, err := http.NewRequest("POST", url, bytes.NewReader(dataBytes))
 	if err != nil {
 		log.WithFields(log.Fields{"message": "build openobserve api error"}).Error(err)
+		return
 	}
 	req.SetBasicAuth(Conf.OpenObserve.UserName, Conf.OpenObserve.Token)
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Fatal(err)
+		log.WithFields(log.Fields{"message": "request openobserve api error"}).Error(err)
+		return
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
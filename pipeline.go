@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// pipelineStage pipeline中单个阶段的运行结果
+type pipelineStage struct {
+	Name     string
+	Duration time.Duration
+	Summary  *RunSummary
+}
+
+func (s pipelineStage) Log() {
+	fields := log.Fields{
+		"stage":     s.Name,
+		"duration":  s.Duration.String(),
+		"succeeded": s.Summary.Succeeded,
+		"unchanged": s.Summary.Unchanged,
+		"failed":    s.Summary.FailedCount(),
+	}
+	if s.Summary.Err != nil {
+		fields["error"] = s.Summary.Err.Error()
+	}
+	log.WithFields(fields).Info("pipeline stage summary")
+}
+
+// getStaleRepositoryNames 从names中筛选出还没有保存或距离上次获取超过staleAfter的仓库, 上次获取时间为最新快照的采集时间
+func getStaleRepositoryNames(store Storage, names []string, staleAfter time.Duration) ([]string, error) {
+	var fresh []string
+	err := store.DB().Model(&Repository{}).
+		Distinct("repositories.full_name").
+		Joins("JOIN repository_snapshots ON repository_snapshots.repository_id = repositories.id").
+		Where("repositories.full_name IN ? AND repository_snapshots.captured_at >= ?", names, time.Now().Add(-staleAfter)).
+		Pluck("repositories.full_name", &fresh).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "load fresh repositories")
+	}
+
+	freshSet := make(map[string]bool, len(fresh))
+	for _, name := range fresh {
+		freshSet[name] = true
+	}
+	stale := make([]string, 0, len(names))
+	for _, name := range names {
+		if !freshSet[name] {
+			stale = append(stale, name)
+		}
+	}
+	return stale, nil
+}
+
+// runPipeline 在一个进程中采集Trending、保存并推送到OpenObserve, 然后只获取新上榜或信息过期的仓库,
+// 不依赖缓存在两个任务之间传递仓库列表
+func runPipeline(client *http.Client, store Storage, sinceType string, languages []string) *RunSummary {
+	summary := NewRunSummary("pipeline", sinceType)
+	var stages []pipelineStage
+	defer func() {
+		for _, stage := range stages {
+			stage.Log()
+		}
+	}()
+
+	// 1. 采集Trending
+	start := time.Now()
+	trendingSummary, names := saveTrendingList(client, store, sinceType, languages)
+	stages = append(stages, pipelineStage{Name: "trending", Duration: time.Since(start), Summary: trendingSummary})
+	summary.Merge(trendingSummary)
+	if trendingSummary.Err != nil || len(names) == 0 {
+		return summary
+	}
+
+	// 2. 筛选需要获取的仓库
+	start = time.Now()
+	filterSummary := NewRunSummary("filter", sinceType)
+	staleAfter := Conf.GetStaleAfter()
+	stale, err := getStaleRepositoryNames(store, names, staleAfter)
+	if err != nil {
+		// 无法判断时获取全部仓库, 仓库信息通过ETag条件请求获取, 未变化时开销很小
+		log.WithFields(log.Fields{"error": err.Error()}).Error("filter stale repositories error, fetch all repositories")
+		stale = names
+	}
+	filterSummary.Unchanged = len(names) - len(stale)
+	filterSummary.Succeeded = len(stale)
+	stages = append(stages, pipelineStage{Name: "filter", Duration: time.Since(start), Summary: filterSummary})
+	log.WithFields(log.Fields{
+		"total":       len(names),
+		"stale":       len(stale),
+		"stale_after": staleAfter.String(),
+	}).Info("filter stale repositories")
+	if len(stale) == 0 {
+		return summary
+	}
+
+	// 3. 获取并保存仓库信息, 执行启用的附加步骤
+	start = time.Now()
+	repoSummary := NewRunSummary("repo", sinceType)
+	saveRepositoryInfo(client, store, stale, repoSummary)
+	stages = append(stages, pipelineStage{Name: "repo", Duration: time.Since(start), Summary: repoSummary})
+	summary.Merge(repoSummary)
+	return summary
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// linkAssociations 根据嵌套的Owner/Organization/License设置外键字段
+func (r *Repository) linkAssociations() {
+	r.OwnerID, r.OrganizationID, r.LicenseKey = nil, nil, nil
+	if r.Owner != nil && r.Owner.ID != 0 {
+		r.OwnerID = &r.Owner.ID
+	}
+	if r.Organization != nil && r.Organization.ID != 0 {
+		r.OrganizationID = &r.Organization.ID
+	}
+	if r.License != nil && r.License.Key != "" {
+		r.LicenseKey = &r.License.Key
+	}
+}
+
+// upsertAll 按主键插入或更新全部字段, UpdateAll会跳过有默认值的updated_time, 需要单独更新
+func upsertAll(tx *gorm.DB, value interface{}) error {
+	return tx.Clauses(clause.OnConflict{
+		UpdateAll: true,
+		DoUpdates: clause.Assignments(map[string]interface{}{"updated_time": gorm.Expr("current_timestamp")}),
+	}).Create(value).Error
+}
+
+// saveRepositories 在一个事务中先upsert仓库关联的Owner/Organization/License, 再upsert仓库本身
+func saveRepositories(db *gorm.DB, repositories []Repository) error {
+	if len(repositories) == 0 {
+		return nil
+	}
+	owners := make(map[int]Owner)
+	organizations := make(map[int]Organization)
+	licenses := make(map[string]License)
+	for i := range repositories {
+		r := &repositories[i]
+		r.linkAssociations()
+		if r.OwnerID != nil {
+			owners[*r.OwnerID] = *r.Owner
+		}
+		if r.OrganizationID != nil {
+			organizations[*r.OrganizationID] = *r.Organization
+		}
+		if r.LicenseKey != nil {
+			licenses[*r.LicenseKey] = *r.License
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(owners) > 0 {
+			list := make([]Owner, 0, len(owners))
+			for _, o := range owners {
+				list = append(list, o)
+			}
+			if err := upsertAll(tx, &list); err != nil {
+				return errors.Wrap(err, "upsert owners")
+			}
+		}
+		if len(organizations) > 0 {
+			list := make([]Organization, 0, len(organizations))
+			for _, o := range organizations {
+				list = append(list, o)
+			}
+			if err := upsertAll(tx, &list); err != nil {
+				return errors.Wrap(err, "upsert organizations")
+			}
+		}
+		if len(licenses) > 0 {
+			list := make([]License, 0, len(licenses))
+			for _, l := range licenses {
+				list = append(list, l)
+			}
+			if err := upsertAll(tx, &list); err != nil {
+				return errors.Wrap(err, "upsert licenses")
+			}
+		}
+		// 关联已经单独upsert, 这里只写仓库表
+		if err := upsertAll(tx.Omit(clause.Associations), &repositories); err != nil {
+			return errors.Wrap(err, "upsert repositories")
+		}
+		return nil
+	})
+}
+
+// trendingRepositories 查询出现在trending中的仓库, 并加载Owner/Organization/License
+func trendingRepositories(db *gorm.DB) *gorm.DB {
+	return db.Model(&Repository{}).
+		Select("repositories.*").
+		Preload("Owner").
+		Preload("Organization").
+		Preload("License").
+		Where("EXISTS (SELECT 1 FROM trendings WHERE trendings.repository = repositories.full_name AND trendings.deleted_time IS NULL)").
+		Order("repositories.stargazers_count DESC")
+}
+
+// GetTrendingRepositoriesByOwner 获取某个用户或组织名下所有上过trending的仓库
+func GetTrendingRepositoriesByOwner(db *gorm.DB, login string) (repositories []Repository, err error) {
+	err = trendingRepositories(db).
+		Joins("JOIN owners ON owners.id = repositories.owner_id").
+		Where("LOWER(owners.login) = LOWER(?)", login).
+		Find(&repositories).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get trending repositories of owner %s", login)
+	}
+	return repositories, nil
+}
+
+// GetTrendingRepositoriesByLicense 获取使用某个许可证的所有上过trending的仓库, key为GitHub的许可证标识, 例如mit
+func GetTrendingRepositoriesByLicense(db *gorm.DB, key string) (repositories []Repository, err error) {
+	err = trendingRepositories(db).
+		Where("repositories.license_key = ?", key).
+		Find(&repositories).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get trending repositories of license %s", key)
+	}
+	return repositories, nil
+}
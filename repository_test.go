@@ -0,0 +1,137 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// seedTrendingRepositories 写入测试用的仓库和trending记录
+func seedTrendingRepositories(t *testing.T) {
+	t.Helper()
+	mit := &License{Key: "mit", Name: "MIT License"}
+	apache := &License{Key: "apache-2.0", Name: "Apache License 2.0"}
+	alice := &Owner{ID: 100, Login: "Alice", Type: "User"}
+	acme := &Owner{ID: 200, Login: "acme", Type: "Organization"}
+	repositories := []Repository{
+		{ID: 1, FullName: "Alice/tool", StargazersCount: 10, Owner: alice, License: mit},
+		{ID: 2, FullName: "Alice/big", StargazersCount: 50, Owner: alice, License: apache},
+		// 没有上过trending
+		{ID: 3, FullName: "Alice/quiet", StargazersCount: 99, Owner: alice, License: mit},
+		{ID: 4, FullName: "acme/lib", StargazersCount: 30, Owner: acme, License: mit,
+			Organization: &Organization{ID: 200, Login: "acme", Type: "Organization"}},
+		{ID: 5, FullName: "acme/old", StargazersCount: 70, Owner: acme, License: mit},
+		{ID: 6, FullName: "acme/unlicensed", StargazersCount: 5, Owner: acme},
+	}
+	if err := saveRepositories(DB, repositories); err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	trendings := []Trending{
+		{Date: date, Since: Daily, Repository: "Alice/tool"},
+		// 同一个仓库出现多次时只返回一次
+		{Date: date, Since: Weekly, Repository: "Alice/tool"},
+		{Date: date, Since: Daily, Repository: "Alice/big"},
+		{Date: date, Since: Daily, Repository: "acme/lib"},
+		{Date: date, Since: Daily, Repository: "acme/old"},
+		{Date: date, Since: Daily, Repository: "acme/unlicensed"},
+	}
+	if err := DB.Create(&trendings).Error; err != nil {
+		t.Fatal(err)
+	}
+	// trending记录已删除的仓库不再返回
+	if err := DB.Model(&Trending{}).Where("repository = ?", "acme/old").Update("deleted_time", date).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func repositoryNames(repositories []Repository) []string {
+	names := make([]string, 0, len(repositories))
+	for _, r := range repositories {
+		names = append(names, r.FullName)
+	}
+	return names
+}
+
+func equalNames(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGetTrendingRepositoriesByOwner(t *testing.T) {
+	newTestDB(t)
+	seedTrendingRepositories(t)
+
+	tests := []struct {
+		login string
+		want  []string
+	}{
+		// 登录名不区分大小写, 按star数降序
+		{login: "alice", want: []string{"Alice/big", "Alice/tool"}},
+		{login: "ACME", want: []string{"acme/lib", "acme/unlicensed"}},
+		{login: "nobody", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.login, func(t *testing.T) {
+			repositories, err := GetTrendingRepositoriesByOwner(DB, tt.login)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := repositoryNames(repositories); !equalNames(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for _, r := range repositories {
+				if r.Owner == nil || r.OwnerID == nil || r.Owner.ID != *r.OwnerID {
+					t.Errorf("%s owner not preloaded: %+v", r.FullName, r.Owner)
+				}
+			}
+		})
+	}
+}
+
+func TestGetTrendingRepositoriesByLicense(t *testing.T) {
+	newTestDB(t)
+	seedTrendingRepositories(t)
+
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{key: "mit", want: []string{"acme/lib", "Alice/tool"}},
+		{key: "apache-2.0", want: []string{"Alice/big"}},
+		{key: "gpl-3.0", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			repositories, err := GetTrendingRepositoriesByLicense(DB, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := repositoryNames(repositories); !equalNames(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for _, r := range repositories {
+				if r.License == nil || r.License.Key != tt.key || r.Owner == nil {
+					t.Errorf("%s associations not preloaded: license %+v, owner %+v", r.FullName, r.License, r.Owner)
+				}
+			}
+		})
+	}
+
+	repositories, err := GetTrendingRepositoriesByLicense(DB, "mit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range repositories {
+		if r.FullName == "acme/lib" && (r.Organization == nil || r.Organization.Login != "acme") {
+			t.Errorf("acme/lib organization not preloaded: %+v", r.Organization)
+		}
+	}
+}
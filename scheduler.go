@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// 定时任务最近一次运行的结果
+const (
+	JobSuccess = "success"
+	JobFailed  = "failed"
+	// JobLocked 其他实例正在运行同一个任务, 本次没有运行
+	JobLocked = "locked"
+)
+
+// jobStatus 定时任务的运行状态
+type jobStatus struct {
+	Name      string     `json:"name"`
+	Cron      string     `json:"cron"`
+	Task      string     `json:"task"`
+	Since     string     `json:"since"`
+	Running   bool       `json:"running"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	Runs      int        `json:"runs"`
+	Skipped   int        `json:"skipped"`
+	LastStart *time.Time `json:"last_start,omitempty"`
+	LastEnd   *time.Time `json:"last_end,omitempty"`
+	// LastDuration 最近一次运行的耗时
+	LastDuration string `json:"last_duration,omitempty"`
+	LastStatus   string `json:"last_status,omitempty"`
+	LastError    string `json:"last_error,omitempty"`
+	Succeeded    int    `json:"succeeded"`
+	Unchanged    int    `json:"unchanged"`
+	Failed       int    `json:"failed"`
+}
+
+// scheduler serve任务中的定时任务调度器, 同一时间只运行一个任务, 同时触发的任务排队执行,
+// 同一个任务上一次还没有结束时跳过本次运行
+type scheduler struct {
+	client *http.Client
+	store  Storage
+	cron   *cron.Cron
+	ctx    context.Context
+
+	// runLock 保证任务串行执行, 避免多个任务同时请求GitHub和写入缓存
+	runLock sync.Mutex
+	mu      sync.Mutex
+	status  map[string]*jobStatus
+	entries map[string]cron.EntryID
+}
+
+func newScheduler(ctx context.Context, client *http.Client, store Storage, location *time.Location) *scheduler {
+	return &scheduler{
+		client:  client,
+		store:   store,
+		cron:    cron.New(cron.WithLocation(location)),
+		ctx:     ctx,
+		status:  make(map[string]*jobStatus),
+		entries: make(map[string]cron.EntryID),
+	}
+}
+
+// add 校验并注册一个定时任务
+func (s *scheduler) add(job ScheduleJob) error {
+	if job.Since == "" {
+		job.Since = Daily
+	}
+	if job.Name == "" {
+		job.Name = job.Task + "_" + job.Since
+	}
+	if _, ok := s.status[job.Name]; ok {
+		return errors.Errorf("duplicate schedule job %s", job.Name)
+	}
+	if !isCollectTask(job.Task) {
+		return errors.Errorf("schedule job %s has unknown task %s", job.Name, job.Task)
+	}
+	if job.Since != Daily && job.Since != Weekly && job.Since != Monthly {
+		return errors.Errorf("schedule job %s has unknown since %s", job.Name, job.Since)
+	}
+	id, err := s.cron.AddFunc(job.Cron, func() { s.run(job) })
+	if err != nil {
+		return errors.Wrapf(err, "schedule job %s has invalid cron %s", job.Name, job.Cron)
+	}
+	s.entries[job.Name] = id
+	s.status[job.Name] = &jobStatus{Name: job.Name, Cron: job.Cron, Task: job.Task, Since: job.Since}
+	log.WithFields(log.Fields{"job": job.Name, "cron": job.Cron, "task": job.Task, "since": job.Since}).Info("add schedule job")
+	return nil
+}
+
+// run 执行一次定时任务并记录运行状态
+func (s *scheduler) run(job ScheduleJob) {
+	status := s.status[job.Name]
+	s.mu.Lock()
+	if status.Running {
+		status.Skipped = status.Skipped + 1
+		s.mu.Unlock()
+		log.WithFields(log.Fields{"job": job.Name}).Warn("schedule job is still running, skip this run")
+		return
+	}
+	status.Running = true
+	s.mu.Unlock()
+
+	s.runLock.Lock()
+	defer s.runLock.Unlock()
+	// 排队期间收到退出信号时不再开始新的任务
+	if s.ctx.Err() != nil {
+		s.mu.Lock()
+		status.Running = false
+		status.Skipped = status.Skipped + 1
+		s.mu.Unlock()
+		log.WithFields(log.Fields{"job": job.Name}).Warn("scheduler is stopping, skip this run")
+		return
+	}
+
+	start := time.Now()
+	log.WithFields(log.Fields{"job": job.Name, "task": job.Task, "since": job.Since}).Info("start schedule job")
+	summary, err := s.runTask(job)
+	end := time.Now()
+
+	s.mu.Lock()
+	status.Running = false
+	status.Runs = status.Runs + 1
+	status.LastStart, status.LastEnd = &start, &end
+	status.LastDuration = end.Sub(start).String()
+	status.LastStatus, status.LastError = JobSuccess, ""
+	status.Succeeded, status.Unchanged, status.Failed = 0, 0, 0
+	if summary != nil {
+		status.Succeeded, status.Unchanged, status.Failed = summary.Succeeded, summary.Unchanged, summary.FailedCount()
+		if err == nil && summary.Exceeded(Conf.GetFailureThreshold()) {
+			err = summary.Err
+			if err == nil {
+				err = errors.Errorf("failure ratio %.2f exceeded threshold", summary.FailureRatio())
+			}
+		}
+	}
+	if errors.Is(err, ErrLocked) {
+		status.Skipped = status.Skipped + 1
+		status.LastStatus, status.LastError = JobLocked, err.Error()
+	} else if err != nil {
+		status.LastStatus, status.LastError = JobFailed, err.Error()
+	}
+	fields := log.Fields{"job": job.Name, "duration": status.LastDuration, "status": status.LastStatus}
+	s.mu.Unlock()
+
+	if summary != nil {
+		summary.Log()
+	}
+	log.WithFields(fields).Info("finish schedule job")
+}
+
+// runTask 执行任务, 任务中的panic会被转换为错误, 避免调度器退出
+func (s *scheduler) runTask(job ScheduleJob) (summary *RunSummary, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("schedule job panic: %v", r)
+			log.WithFields(log.Fields{"job": job.Name, "error": err.Error()}).Error("schedule job panic")
+		}
+	}()
+	return runTask(s.ctx, s.client, s.store, job.Task, job.Since, job.Languages)
+}
+
+// Statuses 返回所有定时任务的运行状态, 按名称排序
+func (s *scheduler) Statuses() []jobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]jobStatus, 0, len(s.status))
+	for name, status := range s.status {
+		st := *status
+		if next := s.cron.Entry(s.entries[name]).Next; !next.IsZero() {
+			st.NextRun = &next
+		}
+		list = append(list, st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ServeHTTP 以JSON格式返回定时任务的运行状态
+func (s *scheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Statuses()); err != nil {
+		log.WithFields(log.Fields{"error": err.Error()}).Error("write schedule status error")
+	}
+}
+
+// serve 以守护进程方式运行, 按配置的cron计划执行采集任务, 收到SIGINT或SIGTERM后等待正在运行的任务结束再退出
+func serve(client *http.Client, store Storage) error {
+	location, err := Conf.GetScheduleLocation()
+	if err != nil {
+		return errors.Wrap(err, "load schedule timezone")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	s := newScheduler(ctx, client, store, location)
+	for _, job := range Conf.GetScheduleJobs() {
+		if err := s.add(job); err != nil {
+			return err
+		}
+	}
+
+	var server *http.Server
+	if addr := Conf.StatusAddr; addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/status", s)
+		server = &http.Server{Addr: addr, Handler: mux}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.WithFields(log.Fields{"addr": addr, "error": err.Error()}).Error("schedule status server error")
+			}
+		}()
+	}
+
+	s.cron.Start()
+	log.WithFields(log.Fields{"jobs": len(s.status), "timezone": location.String(), "status_addr": Conf.StatusAddr}).Info("scheduler started")
+	<-ctx.Done()
+
+	log.Info("receive shutdown signal, wait for running schedule jobs")
+	done := s.cron.Stop()
+	if server != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}
+	timeout := Conf.GetShutdownTimeout()
+	select {
+	case <-done.Done():
+		log.Info("scheduler stopped")
+		return nil
+	case <-time.After(timeout):
+		return errors.Errorf("running schedule jobs not finished in %s", timeout)
+	}
+}
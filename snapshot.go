@@ -0,0 +1,48 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// newRepositorySnapshot 根据仓库当前的统计数据生成快照
+func newRepositorySnapshot(r Repository, capturedAt time.Time) RepositorySnapshot {
+	return RepositorySnapshot{
+		RepositoryID: r.ID,
+		CapturedAt:   capturedAt,
+		Stars:        r.StargazersCount,
+		Forks:        r.ForksCount,
+		OpenIssues:   r.OpenIssuesCount,
+		Watchers:     r.SubscribersCount,
+		Size:         r.Size,
+	}
+}
+
+// saveRepositorySnapshots 保存一批仓库的统计快照
+func saveRepositorySnapshots(db *gorm.DB, repositories []Repository, capturedAt time.Time) error {
+	if len(repositories) == 0 {
+		return nil
+	}
+	snapshots := make([]RepositorySnapshot, 0, len(repositories))
+	for _, r := range repositories {
+		snapshots = append(snapshots, newRepositorySnapshot(r, capturedAt))
+	}
+	return db.Create(&snapshots).Error
+}
+
+// GetRepositorySnapshots 获取仓库在[from, to)时间范围内的统计快照, 按采集时间升序排列, to为零值时不限制结束时间
+func GetRepositorySnapshots(db *gorm.DB, fullName string, from, to time.Time) (snapshots []RepositorySnapshot, err error) {
+	query := db.Model(&RepositorySnapshot{}).
+		Joins("JOIN repositories ON repositories.id = repository_snapshots.repository_id").
+		Where("repositories.full_name = ? AND repository_snapshots.captured_at >= ?", fullName, from)
+	if !to.IsZero() {
+		query = query.Where("repository_snapshots.captured_at < ?", to)
+	}
+	err = query.Order("repository_snapshots.captured_at").Find(&snapshots).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get snapshots of %s", fullName)
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetRepositorySnapshots(t *testing.T) {
+	db := newTestDB(t)
+	repositories := []Repository{{ID: 1, FullName: "alice/tool"}, {ID: 2, FullName: "acme/lib"}}
+	if err := saveRepositories(db, repositories); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	// 按打乱的顺序写入, 查询结果应按采集时间升序
+	for i, offset := range []int{2, 0, -1, 1} {
+		repositories[0].StargazersCount = 100 + i
+		if err := saveRepositorySnapshots(db, repositories[:1], base.Add(time.Duration(offset)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := saveRepositorySnapshots(db, repositories[1:], base.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		from  time.Time
+		to    time.Time
+		hours []int
+		stars []int
+	}{
+		{name: "open end", from: base, hours: []int{0, 1, 2}, stars: []int{101, 103, 100}},
+		{name: "to is exclusive", from: base, to: base.Add(2 * time.Hour), hours: []int{0, 1}, stars: []int{101, 103}},
+		{name: "from is inclusive", from: base.Add(-time.Hour), to: base, hours: []int{-1}, stars: []int{102}},
+		{name: "empty range", from: base.Add(3 * time.Hour), hours: []int{}, stars: []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshots, err := GetRepositorySnapshots(db, "alice/tool", tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(snapshots) != len(tt.hours) {
+				t.Fatalf("got %d snapshots, want %d", len(snapshots), len(tt.hours))
+			}
+			for i, s := range snapshots {
+				want := base.Add(time.Duration(tt.hours[i]) * time.Hour)
+				if s.RepositoryID != 1 || !s.CapturedAt.Equal(want) || s.Stars != tt.stars[i] {
+					t.Errorf("snapshot %d = repository %d at %s with %d stars, want repository 1 at %s with %d stars",
+						i, s.RepositoryID, s.CapturedAt, s.Stars, want, tt.stars[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 支持的数据库类型, 与gorm Dialector.Name()一致
+const (
+	PostgresDriver = "postgres"
+	MysqlDriver    = "mysql"
+	SqliteDriver   = "sqlite"
+)
+
+// Storage 采集任务读写Trending和仓库信息的存储后端, 其他表直接通过DB()使用gorm读写
+type Storage interface {
+	DB() *gorm.DB
+	// LoadTrendings 获取某天某个since类型已保存的Trending记录
+	LoadTrendings(date time.Time, sinceType string) ([]Trending, error)
+	// UpsertTrendings 按(date, since, language, spoken_language, repository)分批写入Trending记录,
+	// 已存在时保留较大的stars、最好的名次和最早的上榜时间
+	UpsertTrendings(trendings []Trending) error
+	// UpsertRepositories 写入仓库信息以及关联的Owner/Organization/License
+	UpsertRepositories(repositories []Repository) error
+}
+
+// sqlDialect 各数据库upsert语法的差异
+type sqlDialect struct {
+	// greatest/least 多参数取最大/最小值的函数, SQLite使用MAX/MIN
+	greatest string
+	least    string
+	// excluded 冲突时本次要写入的列值
+	excluded func(column string) clause.Expr
+}
+
+var (
+	postgresDialect = sqlDialect{greatest: "GREATEST", least: "LEAST", excluded: excludedColumn}
+	sqliteDialect   = sqlDialect{greatest: "MAX", least: "MIN", excluded: excludedColumn}
+	mysqlDialect    = sqlDialect{
+		greatest: "GREATEST",
+		least:    "LEAST",
+		excluded: func(column string) clause.Expr {
+			return gorm.Expr("VALUES(?)", clause.Column{Name: column})
+		},
+	}
+)
+
+// excludedColumn Postgres和SQLite的ON CONFLICT DO UPDATE中通过excluded引用本次写入的值
+func excludedColumn(column string) clause.Expr {
+	return gorm.Expr("?", clause.Column{Table: "excluded", Name: column})
+}
+
+// newest 冲突时使用本次写入的值
+func (d sqlDialect) newest(column string) clause.Expr {
+	return d.excluded(column)
+}
+
+// keep 冲突时在已有值和本次写入的值中取最大或最小值, 已有值为NULL时使用本次写入的值
+func (d sqlDialect) keep(fn, column string) clause.Expr {
+	current := clause.Column{Table: "trendings", Name: column}
+	return gorm.Expr(fn+"(COALESCE(?, ?), ?)", current, d.excluded(column), d.excluded(column))
+}
+
+// gormStorage 基于gorm的存储实现, 通过sqlDialect适配Postgres、MySQL和SQLite
+type gormStorage struct {
+	db      *gorm.DB
+	dialect sqlDialect
+}
+
+func (s *gormStorage) DB() *gorm.DB {
+	return s.db
+}
+
+func (s *gormStorage) LoadTrendings(date time.Time, sinceType string) (trendings []Trending, err error) {
+	err = s.db.Select("id", "repository", "language", "spoken_language").
+		Where(&Trending{Date: date, Since: sinceType}).
+		Find(&trendings).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "load trending records")
+	}
+	return trendings, nil
+}
+
+func (s *gormStorage) UpsertTrendings(trendings []Trending) error {
+	if len(trendings) == 0 {
+		return nil
+	}
+	d := s.dialect
+	return s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "date"}, {Name: "since"}, {Name: "language"}, {Name: "spoken_language"}, {Name: "repository"},
+		},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"stars":         d.keep(d.greatest, "stars"),
+			"description":   d.newest("description"),
+			"repo_language": d.newest("repo_language"),
+			"total_stars":   d.newest("total_stars"),
+			"forks":         d.newest("forks"),
+			"built_by":      d.newest("built_by"),
+			"rank":          d.keep(d.least, "rank"),
+			"first_seen_at": d.keep(d.least, "first_seen_at"),
+			"last_seen_at":  d.keep(d.greatest, "last_seen_at"),
+			"updated_time":  gorm.Expr("current_timestamp"),
+		}),
+	}).CreateInBatches(&trendings, Conf.GetDBBatchSize()).Error
+}
+
+func (s *gormStorage) UpsertRepositories(repositories []Repository) error {
+	return saveRepositories(s.db, repositories)
+}
+
+// openStorage 根据db.driver配置连接数据库
+func openStorage(driver, dsn string, config *gorm.Config) (Storage, error) {
+	var (
+		dialector gorm.Dialector
+		dialect   sqlDialect
+	)
+	switch driver {
+	case PostgresDriver:
+		dialector, dialect = postgres.Open(dsn), postgresDialect
+	case MysqlDriver:
+		// 模型中的default:current_timestamp不带精度, datetime(3)会被MySQL拒绝(Error 1067), 统一使用不带精度的datetime
+		dialector = mysql.New(mysql.Config{DSN: dsn, DisableDatetimePrecision: true})
+		dialect = mysqlDialect
+	case SqliteDriver:
+		dialector, dialect = sqlite.Open(dsn), sqliteDialect
+	default:
+		return nil, errors.Errorf("unknown db driver %s, choice are postgres, mysql, sqlite", driver)
+	}
+	db, err := gorm.Open(dialector, config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "connect %s database", driver)
+	}
+	log.WithFields(log.Fields{"driver": driver}).Info("connect database")
+	return &gormStorage{db: db, dialect: dialect}, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB 创建临时的sqlite数据库并通过MigrateDB建表, 测试结束后随临时目录一起删除
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	if Conf == nil {
+		Conf = &Config{}
+	}
+	store, err := openStorage(SqliteDriver, filepath.Join(t.TempDir(), "test.db"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	DB = store.DB()
+	MigrateDB()
+	t.Cleanup(func() {
+		if sqlDB, err := DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return DB
+}
+
+func TestUpsertTrendings(t *testing.T) {
+	base := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	at := func(hours int) *time.Time {
+		t := base.Add(time.Duration(hours) * time.Hour)
+		return &t
+	}
+	// newTrendings 生成两个语言范围下各n个仓库的记录, fn设置每条记录的统计值
+	newTrendings := func(n int, fn func(i int, trending *Trending)) []Trending {
+		trendings := make([]Trending, 0, n*2)
+		for _, language := range []string{"go", "rust"} {
+			for i := 0; i < n; i++ {
+				trending := Trending{
+					Date:       base.Truncate(24 * time.Hour),
+					Since:      Daily,
+					Language:   language,
+					Repository: fmt.Sprintf("owner/repo-%d", i),
+				}
+				fn(i, &trending)
+				trendings = append(trendings, trending)
+			}
+		}
+		return trendings
+	}
+
+	tests := []struct {
+		name      string
+		batchSize int
+		n         int
+	}{
+		{name: "over batch size", batchSize: 10, n: 25},
+		// 单条语句会超过SQLite的参数数量限制
+		{name: "whole run", n: 1250},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			Conf.BatchSize = tt.batchSize
+			t.Cleanup(func() { Conf.BatchSize = 0 })
+			store := &gormStorage{db: db, dialect: sqliteDialect}
+
+			first := newTrendings(tt.n, func(i int, trending *Trending) {
+				trending.Stars, trending.Rank, trending.Description = 100, 5, "old"
+				trending.FirstSeenAt, trending.LastSeenAt = at(1), at(1)
+			})
+			if err := store.UpsertTrendings(first); err != nil {
+				t.Fatal(err)
+			}
+			// 偶数仓库第二次的值更小更早, 奇数仓库更大更晚
+			second := newTrendings(tt.n, func(i int, trending *Trending) {
+				trending.Description = "new"
+				if i%2 == 0 {
+					trending.Stars, trending.Rank = 80, 3
+					trending.FirstSeenAt, trending.LastSeenAt = at(0), at(0)
+				} else {
+					trending.Stars, trending.Rank = 120, 7
+					trending.FirstSeenAt, trending.LastSeenAt = at(2), at(2)
+				}
+			})
+			if err := store.UpsertTrendings(second); err != nil {
+				t.Fatal(err)
+			}
+
+			var saved []Trending
+			if err := db.Order("id").Find(&saved).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(saved) != tt.n*2 {
+				t.Fatalf("got %d rows, want %d", len(saved), tt.n*2)
+			}
+			for _, trending := range saved {
+				var i int
+				fmt.Sscanf(trending.Repository, "owner/repo-%d", &i)
+				wantStars, wantRank, wantFirst, wantLast := 100, 3, at(0), at(1)
+				if i%2 == 1 {
+					wantStars, wantRank, wantFirst, wantLast = 120, 5, at(1), at(2)
+				}
+				if trending.Stars != wantStars || trending.Rank != wantRank || trending.Description != "new" ||
+					trending.FirstSeenAt == nil || !trending.FirstSeenAt.Equal(*wantFirst) ||
+					trending.LastSeenAt == nil || !trending.LastSeenAt.Equal(*wantLast) {
+					t.Fatalf("%s %s = stars %d, rank %d, description %q, seen %v - %v; want stars %d, rank %d, seen %s - %s",
+						trending.Language, trending.Repository, trending.Stars, trending.Rank, trending.Description,
+						trending.FirstSeenAt, trending.LastSeenAt, wantStars, wantRank, wantFirst, wantLast)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+-- 引入迁移脚本之前init_db(AutoMigrate)在Postgres上创建的表结构, 用于测试0001在旧数据库上执行
+-- licenses上的fk_repositories_license为varchar引用bigint, Postgres无法创建, 这里不包含
+CREATE TABLE repositories (
+    id                bigint PRIMARY KEY,
+    node_id           varchar(64),
+    name              varchar(64),
+    full_name         varchar(256) NOT NULL,
+    private           boolean,
+    html_url          varchar(512),
+    description       text,
+    fork              boolean,
+    url               varchar(512),
+    forks_url         varchar(256),
+    events_url        varchar(256),
+    languages_url     varchar(256),
+    downloads_url     varchar(256),
+    created_at        timestamptz,
+    updated_at        timestamptz,
+    pushed_at         timestamptz,
+    git_url           varchar(256),
+    clone_url         varchar(256),
+    homepage          varchar(256),
+    size              bigint,
+    stargazers_count  bigint,
+    language          varchar(32),
+    has_issues        boolean,
+    has_projects      boolean,
+    has_downloads     boolean,
+    has_wiki          boolean,
+    has_pages         boolean,
+    forks_count       bigint,
+    archived          boolean,
+    disabled          boolean,
+    open_issues_count bigint,
+    topics            varchar(32)[],
+    visibility        varchar(32),
+    subscribers_count bigint,
+    updated_time      timestamptz DEFAULT current_timestamp,
+    deleted_time      timestamptz DEFAULT null
+);
+CREATE UNIQUE INDEX idx_repositories_full_name ON repositories (full_name);
+
+CREATE TABLE owners (
+    id           bigint PRIMARY KEY,
+    login        varchar(64),
+    node_id      varchar(64),
+    avatar_url   varchar(512),
+    url          varchar(512),
+    html_url     varchar(512),
+    repos_url    varchar(512),
+    type         varchar(32),
+    site_admin   boolean,
+    updated_time timestamptz DEFAULT current_timestamp,
+    deleted_time timestamptz DEFAULT null,
+    CONSTRAINT fk_repositories_owner FOREIGN KEY (id) REFERENCES repositories (id)
+);
+
+CREATE TABLE organizations (
+    id           bigint PRIMARY KEY,
+    login        varchar(64),
+    node_id      varchar(64),
+    avatar_url   varchar(512),
+    html_url     varchar(512),
+    type         varchar(32),
+    site_admin   boolean,
+    updated_time timestamptz DEFAULT current_timestamp,
+    deleted_time timestamptz DEFAULT null,
+    CONSTRAINT fk_repositories_organization FOREIGN KEY (id) REFERENCES repositories (id)
+);
+
+CREATE TABLE licenses (
+    key          varchar(16) PRIMARY KEY,
+    name         varchar(64),
+    spdx_id      varchar(64),
+    url          varchar(512),
+    node_id      varchar(64),
+    updated_time timestamptz DEFAULT current_timestamp,
+    deleted_time timestamptz DEFAULT null
+);
+
+CREATE TABLE trendings (
+    id           bigserial PRIMARY KEY,
+    date         date,
+    repository   varchar(256),
+    stars        integer,
+    since        varchar(16),
+    language     varchar(32),
+    updated_time timestamptz DEFAULT current_timestamp,
+    deleted_time timestamptz DEFAULT null
+);
+
+INSERT INTO repositories (id, name, full_name, stargazers_count) VALUES (1, 'tool', 'alice/tool', 10);
+INSERT INTO owners (id, login, type) VALUES (1, 'alice', 'User');
+-- 并发运行产生的重复记录, 0003执行后只保留stars最大的一条
+INSERT INTO trendings (date, repository, stars, since, language) VALUES
+    ('2024-05-01', 'alice/tool', 5, 'daily', 'go'),
+    ('2024-05-01', 'alice/tool', 8, 'daily', 'go'),
+    ('2024-05-02', 'alice/tool', 3, 'daily', 'go');
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// StringArray 字符串列表字段, Postgres使用varchar数组, MySQL和SQLite没有数组类型, 使用JSON保存
+type StringArray []string
+
+func (StringArray) GormDataType() string {
+	return "string_array"
+}
+
+// GormDBDataType 根据数据库类型返回列类型, 数组元素长度使用size标签
+func (StringArray) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case PostgresDriver:
+		if field.Size > 0 {
+			return fmt.Sprintf("varchar(%d)[]", field.Size)
+		}
+		return "text[]"
+	case MysqlDriver:
+		return "json"
+	default:
+		return "text"
+	}
+}
+
+// GormValue Postgres直接传递[]string由驱动编码为数组, 其他数据库写入JSON字符串
+func (a StringArray) GormValue(_ context.Context, db *gorm.DB) clause.Expr {
+	if a == nil {
+		return clause.Expr{SQL: "NULL"}
+	}
+	if db.Dialector.Name() == PostgresDriver {
+		return clause.Expr{SQL: "?", Vars: []interface{}{[]string(a)}}
+	}
+	value, _ := a.Value()
+	return clause.Expr{SQL: "?", Vars: []interface{}{value}}
+}
+
+// Value 不经过gorm写入时(例如查询条件)使用JSON格式
+func (a StringArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal([]string(a))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan 兼容JSON格式和Postgres数组的文本格式
+func (a *StringArray) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return errors.Errorf("unsupported type %T for StringArray", src)
+	}
+
+	if strings.HasPrefix(text, "{") {
+		list, err := parsePostgresArray(text)
+		if err != nil {
+			return err
+		}
+		*a = list
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(text), &list); err != nil {
+		return errors.Wrapf(err, "unmarshal StringArray %s", text)
+	}
+	*a = list
+	return nil
+}
+
+// parsePostgresArray 解析一维Postgres数组的文本格式, 例如{go,"hello world",NULL}, NULL元素会被忽略
+func parsePostgresArray(text string) ([]string, error) {
+	if !strings.HasPrefix(text, "{") || !strings.HasSuffix(text, "}") {
+		return nil, errors.Errorf("invalid postgres array %s", text)
+	}
+	body := text[1 : len(text)-1]
+	list := make([]string, 0)
+	if body == "" {
+		return list, nil
+	}
+
+	var (
+		item    strings.Builder
+		quoted  bool
+		inQuote bool
+		escaped bool
+	)
+	flush := func() {
+		if value := item.String(); quoted || value != "NULL" {
+			list = append(list, value)
+		}
+		item.Reset()
+		quoted = false
+	}
+	for _, r := range body {
+		switch {
+		case escaped:
+			item.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+			quoted = true
+		case r == ',' && !inQuote:
+			flush()
+		default:
+			item.WriteRune(r)
+		}
+	}
+	if inQuote || escaped {
+		return nil, errors.Errorf("invalid postgres array %s", text)
+	}
+	flush()
+	return list, nil
+}
+
+// LongText 可能超过64KB的文本字段, MySQL的text最多保存64KB, 使用longtext, 其他数据库使用text
+type LongText string
+
+func (LongText) GormDataType() string {
+	return "long_text"
+}
+
+func (LongText) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	if db.Dialector.Name() == MysqlDriver {
+		return "longtext"
+	}
+	return "text"
+}
+
+func (t LongText) Value() (driver.Value, error) {
+	return string(t), nil
+}
+
+func (t *LongText) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*t = ""
+	case []byte:
+		*t = LongText(v)
+	case string:
+		*t = LongText(v)
+	default:
+		return errors.Errorf("unsupported type %T for LongText", src)
+	}
+	return nil
+}